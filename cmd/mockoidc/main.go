@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/auth/oidctest"
+)
+
+// Runs a local OpenID Connect provider for trying out social login during development.
+// Point the backend at it with:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=common-circle
+//	OIDC_MOCK_REDIRECT_URL=http://localhost:8000/api/v1/auth/mock/callback
+func main() {
+	port := flag.String("port", "9000", "port to listen on")
+	clientID := flag.String("client-id", "common-circle", "client ID accepted by the provider")
+	subject := flag.String("sub", "mock-user-1", "subject of the signed in user")
+	email := flag.String("email", "mock.user@example.com", "email of the signed in user")
+	emailVerified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	username := flag.String("username", "mockuser", "preferred_username of the signed in user")
+	flag.Parse()
+
+	issuer := fmt.Sprintf("http://localhost:%s", *port)
+	provider, err := oidctest.NewProvider(issuer, *clientID)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	provider.SetIdentity(oidctest.Identity{
+		Subject:           *subject,
+		Email:             *email,
+		EmailVerified:     *emailVerified,
+		PreferredUsername: *username,
+		Name:              *username,
+	})
+
+	fmt.Printf("Mock OIDC provider listening at %s for client %s\n", issuer, *clientID)
+	log.Fatalln(http.ListenAndServe(":"+*port, provider.Handler()))
+}
@@ -1,23 +1,167 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/blobfish465/common-circle-web-forum/internal/antispam"
+	"github.com/blobfish465/common-circle-web-forum/internal/auth"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/mailer"
+	"github.com/blobfish465/common-circle-web-forum/internal/metrics"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/ratelimit"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
 	"github.com/blobfish465/common-circle-web-forum/internal/router"
+	"github.com/blobfish465/common-circle-web-forum/internal/store/postgres"
+	"github.com/blobfish465/common-circle-web-forum/internal/tracing"
+	"github.com/blobfish465/common-circle-web-forum/internal/utils"
 )
 
 func main() {
-	r := router.Setup()
+	configFile := flag.String("config", "", "YAML or TOML config file (default $CONFIG_FILE)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config file] [config print]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load(config.Options{File: *configFile})
+
+	// "config print" shows the effective configuration and any problems with it, then exits
+	if args := flag.Args(); len(args) > 0 {
+		if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if cfg != nil {
+			config.Print(os.Stdout, cfg)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logging.Setup(cfg.Log)
+	utils.SetJWTSecret(cfg.Auth.JWTSecret)
+	mailer.Configure(cfg.Mail)
+	auth.ConfigureOIDC(cfg.OIDC, cfg.Auth.PostLoginRedirect)
+	antispam.Configure(cfg.AntiSpam)
+
+	if err := run(cfg); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the API until SIGINT or SIGTERM, then lets in-flight requests finish for up
+// to the shutdown timeout before closing the database pool
+func run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	// Flush the spans of the last requests once they have drained
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+	}()
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	defer db.Close()
+	database.SetDefault(db)
+	database.RegisterPoolMetrics(db.DB)
+
+	// Recompute reputation every night to correct any drift in the incremental updates
+	go reputation.RunNightly(ctx, cfg.Reputation.ReconcileHour)
+
+	var limitStore ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		limitStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		limitStore = ratelimit.NewPostgresStore(db)
+	}
+	limits := middleware.NewRateLimits(cfg.RateLimit, limitStore)
+
+	handler := router.Setup(postgres.New(db), cfg.CORS, cfg.API, cfg.Metrics, limits)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000" // Default to port 8000 if PORT is not set
-		// to ensure backend still works locally when running outside Render.
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
 	}
 
-	fmt.Printf("Listening on port %s at http://0.0.0.0:%s!\n", port, port)
-	log.Fatalln(http.ListenAndServe(":"+port, r))
+	servers := []*http.Server{server}
+	if cfg.Metrics.Addr != "" {
+		// Scrapers reach the metrics on an address of their own, away from the API
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(cfg.Metrics.Token))
+		servers = append(servers, &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ErrorLog:          server.ErrorLog,
+		})
+	} else if cfg.Metrics.Token == "" {
+		slog.Info("metrics are not served, as neither METRICS_ADDR nor METRICS_TOKEN is set")
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			slog.Info("listening", "addr", server.Addr)
+			serveErr <- server.ListenAndServe()
+		}(server)
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			server.Close()
+			return fmt.Errorf("failed to drain requests: %w", err)
+		}
+	}
+	slog.Info("server stopped")
+	return nil
 }
@@ -2,7 +2,7 @@ import axios from 'axios';
 import Cookies from 'js-cookie';
 
 const axiosInstance = axios.create({
-    baseURL: 'https://common-circle-web-forum.onrender.com',
+    baseURL: 'https://common-circle-web-forum.onrender.com/api/v1',
     headers: {
         'Content-Type': 'application/json',
     },
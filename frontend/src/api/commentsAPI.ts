@@ -1,8 +1,8 @@
 import axiosInstance from './axiosInstance';
-import { Comment } from '../types/comment';
+import { Comment, CommentInput } from '../types/comment';
 
 
-export const createComment = async (comment: Omit<Comment, 'id'>) => {
+export const createComment = async (comment: CommentInput) => {
     try {
         const response = await axiosInstance.post('/comments', comment);
         return response.data.payload.data; 
@@ -1,9 +1,9 @@
 import axiosInstance from './axiosInstance';
-import { Thread } from '../types/thread';
+import { Thread, ThreadInput } from '../types/thread';
 
 
 
-export const createThread = async (thread: Omit<Thread, 'id'>) => {
+export const createThread = async (thread: ThreadInput) => {
     const response = await axiosInstance.post('/threads', thread);
     return response.data;
 };
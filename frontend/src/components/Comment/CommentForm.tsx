@@ -23,9 +23,7 @@ const CommentForm: React.FC<CommentFormProps> = ({ threadId, userId, onCommentAd
     try {
       const newComment = {
         thread_id: threadId,
-        user_id: userId,
         content,
-        created_at: new Date().toISOString(),
       };
 
       const createdComment = await createComment(newComment);
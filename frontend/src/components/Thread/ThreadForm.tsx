@@ -4,7 +4,7 @@ import { createThread } from '../../api/threadsAPI';
 import { Button, TextField, MenuItem, Select, FormControl, InputLabel } from '@mui/material';
 import { getCategories } from '../../api/categoriesAPI';
 import { Category } from 'types/category';
-import { Thread } from 'types/thread';
+import { ThreadInput } from 'types/thread';
 
 interface ThreadFormProps {
   userId: number;
@@ -39,14 +39,9 @@ const ThreadForm: React.FC<ThreadFormProps> = ({ userId }) => {
         }
 
         try {
-            const singaporeTime = new Date();
-            singaporeTime.setHours(singaporeTime.getHours() + 8); // UTC +8
-
-            const newThread: Omit<Thread, 'id'> = {
-                user_id: userId,  
+            const newThread: ThreadInput = {
                 title,
                 content,
-                created_at: singaporeTime.toISOString(), 
                 category_id: categoryId,
             };
             
@@ -46,7 +46,7 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     }, []);
 
     const login = async (username: string, password: string) => {
-        const response = await fetch('https://common-circle-web-forum.onrender.com/login', {
+        const response = await fetch('https://common-circle-web-forum.onrender.com/api/v1/login', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ username, password }),
@@ -58,7 +58,7 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
             console.log('Decoded token:', decoded); 
             setAuth({ userId: decoded.user_id, token: data.token });
         } else {
-            throw new Error(data.message || 'Login failed');
+            throw new Error(data.messages?.[0] || 'Login failed');
         }
     };
 
@@ -69,13 +69,9 @@ const ThreadDetails: React.FC = () => {
   // directly adjust timezone offset programmatically as 
   // using toLocaleString() does not preserve time precision when converting to a string
   // and new Date() might misinterpret the resulting string. 
+  // Timestamps from the API are RFC 3339 in UTC, so only the display time zone needs choosing
   const adjustToSingaporeTime = (isoDate: string): string => {
-    const date = new Date(isoDate);
-    const singaporeOffset = 8 * 60; // Singapore is UTC+8
-    const localOffset = date.getTimezoneOffset(); // Local timezone offset in minutes
-    const offsetDifference = singaporeOffset - localOffset;
-    date.setMinutes(date.getMinutes() + offsetDifference);
-    return date.toLocaleString('en-SG', { hour12: false }); // 24-hour format
+    return new Date(isoDate).toLocaleString('en-SG', { timeZone: 'Asia/Singapore', hour12: false }); // 24-hour format
   };
 
   if (error) {
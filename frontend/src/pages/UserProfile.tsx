@@ -75,9 +75,11 @@ const UserProfile: React.FC = () => {
         <Typography variant="h4" gutterBottom>
           {user.username}'s Profile
         </Typography>
-        <Typography variant="body1" gutterBottom>
-          Email: {user.email}
-        </Typography>
+        {user.email && (
+          <Typography variant="body1" gutterBottom>
+            Email: {user.email}
+          </Typography>
+        )}
         <Divider style={{ margin: '1rem 0' }} />
 
         <Typography variant="h5">Your Threads</Typography>
@@ -5,4 +5,7 @@ export interface Comment {
     updated_at?: string; 
     user_id: number;
     thread_id: number;
-}
\ No newline at end of file
+}
+
+// Fields sent when creating a comment, the author is taken from the login token
+export type CommentInput = Pick<Comment, 'content' | 'thread_id'>;
\ No newline at end of file
@@ -6,4 +6,10 @@ export interface Thread {
     created_at: string; 
     updated_at?: string; 
     category_id: number;
-}
\ No newline at end of file
+    accepted_comment_id?: number;
+    author_username?: string;
+    author_reputation?: number;
+}
+
+// Fields sent when creating a thread, the author is taken from the login token
+export type ThreadInput = Pick<Thread, 'title' | 'content' | 'category_id'>;
\ No newline at end of file
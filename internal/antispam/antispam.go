@@ -0,0 +1,123 @@
+// Package antispam enforces the posting rules that keep new threads and comments from
+// being used for spam: a cooldown between posts, a daily cap and a link limit for new
+// accounts, and no reposting the same content.
+package antispam
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/validation"
+)
+
+// historyLimit bounds how many recent posts are checked for duplicates
+const historyLimit = 100
+
+// rules are the rules given to Configure. Until then every rule is off.
+var rules config.AntiSpam
+
+// Configure sets the rules CheckPost enforces
+func Configure(cfg config.AntiSpam) {
+	rules = cfg
+}
+
+// linkPattern matches the links counted against new accounts
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// CheckPost returns an error if the user may not post a thread or comment with the given
+// title and content now. Waiting out a cooldown or cap is a rate limited error, too many
+// links an invalid content field and a repeated post a conflict. Comments have no title.
+//
+// The check only holds if nothing is posted between it and the insert, so callers run
+// both in one transaction and pass its stores. Concurrent posts by the same user then
+// conflict, and the retried transaction sees the post that won.
+func CheckPost(ctx context.Context, stores *store.Stores, userID int, title string, content string) error {
+	user, err := stores.Users.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user %d: %w", userID, err)
+	}
+
+	now := time.Now().UTC()
+	newAccount := rules.NewAccountDays > 0 && now.Sub(user.CreatedAt) < time.Duration(rules.NewAccountDays)*24*time.Hour
+
+	// Links are checked first as they need no history
+	if newAccount && rules.NewAccountMaxLinks > 0 {
+		if links := len(linkPattern.FindAllString(title+"\n"+content, -1)); links > rules.NewAccountMaxLinks {
+			return validation.Field("content", "can contain at most %d links until your account is %d days old",
+				rules.NewAccountMaxLinks, rules.NewAccountDays)
+		}
+	}
+
+	window := max(rules.MinPostInterval, rules.DuplicateWindow)
+	limit := historyLimit
+	if newAccount && rules.NewAccountDailyPosts > 0 {
+		window = max(window, 24*time.Hour)
+		limit = max(limit, rules.NewAccountDailyPosts)
+	}
+	if window == 0 {
+		return nil
+	}
+	posts, err := stores.Users.ListPostsSince(ctx, userID, now.Add(-window), limit)
+	if err != nil {
+		return fmt.Errorf("failed to fetch recent posts of user %d: %w", userID, err)
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+
+	if wait := posts[0].CreatedAt.Add(rules.MinPostInterval).Sub(now); rules.MinPostInterval > 0 && wait > 0 {
+		return apperrors.RateLimited("Please wait %s before posting again", roundUp(wait))
+	}
+
+	if newAccount && rules.NewAccountDailyPosts > 0 {
+		if postedToday := countSince(posts, now.Add(-24*time.Hour)); postedToday >= rules.NewAccountDailyPosts {
+			// A post becomes possible again once the oldest of the day's posts is a day old
+			wait := posts[rules.NewAccountDailyPosts-1].CreatedAt.Add(24 * time.Hour).Sub(now)
+			return apperrors.RateLimited("New accounts can post %d times a day, try again in %s",
+				rules.NewAccountDailyPosts, roundUp(wait))
+		}
+	}
+
+	if rules.DuplicateWindow > 0 {
+		normalized := normalize(content)
+		since := now.Add(-rules.DuplicateWindow)
+		for _, post := range posts {
+			if post.CreatedAt.After(since) && normalize(post.Content) == normalized {
+				return apperrors.Conflict("You have already posted this %s", post.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// countSince counts the posts, newest first, made after since
+func countSince(posts []models.Post, since time.Time) int {
+	for i, post := range posts {
+		if !post.CreatedAt.After(since) {
+			return i
+		}
+	}
+	return len(posts)
+}
+
+// normalize makes content that differs only in case or whitespace compare equal
+func normalize(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
+
+// roundUp rounds d up to whole seconds, or minutes when it is longer than a few of them
+func roundUp(d time.Duration) time.Duration {
+	unit := time.Second
+	if d > 5*time.Minute {
+		unit = time.Minute
+	}
+	return time.Duration(math.Ceil(float64(d)/float64(unit))) * unit
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
 )
 
 type Payload struct {
@@ -10,7 +12,8 @@ type Payload struct {
 }
 
 type Response struct {
-	Payload   Payload  `json:"payload"`
-	Messages  []string `json:"messages"`
-	ErrorCode int      `json:"errorCode"`
+	Payload   Payload                `json:"payload"`
+	Messages  []string               `json:"messages"`
+	ErrorCode int                    `json:"errorCode"`
+	Errors    []apperrors.FieldError `json:"errors,omitempty"`
 }
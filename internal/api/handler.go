@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Handler handles a request and returns the response to send, or an error that WriteError
+// turns into the matching status code. Handlers never write to the ResponseWriter themselves.
+type Handler func(r *http.Request) (*Response, error)
+
+// Handle adapts a Handler to an http.HandlerFunc that responds with 200 OK on success
+func Handle(h Handler) http.HandlerFunc {
+	return HandleWithStatus(http.StatusOK, h)
+}
+
+// Created adapts a Handler that creates a resource, responding with 201 Created on success
+func Created(h Handler) http.HandlerFunc {
+	return HandleWithStatus(http.StatusCreated, h)
+}
+
+// HandleWithStatus adapts a Handler to an http.HandlerFunc that responds with status on success
+func HandleWithStatus(status int, h Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, err := h(r)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if response == nil {
+			response = &Response{}
+		}
+		WriteJSON(w, status, response)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/validation"
+)
+
+// MaxBodyBytes limits the size of JSON request bodies
+const MaxBodyBytes = 1 << 20
+
+// Decode reads a JSON request body into a value of type T and checks it against its
+// `validate` tags. A malformed body is a validation error and a body that breaks the
+// rules is an invalid error listing the offending fields.
+func Decode[T any](r *http.Request) (T, error) {
+	var value T
+	body := http.MaxBytesReader(nil, r.Body, MaxBodyBytes)
+	if err := json.NewDecoder(body).Decode(&value); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return value, apperrors.Validation("request body cannot be larger than %d bytes", MaxBodyBytes)
+		}
+		return value, apperrors.Validation("invalid request body: %v", err)
+	}
+	if err := validation.Struct(&value).Err(); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Data builds a successful response whose payload data is v encoded as JSON
+func Data(v interface{}, messages ...string) (*Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Payload:  Payload{Data: data},
+		Messages: messages,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+)
+
+// Error codes set in Response.ErrorCode, so clients can tell failures apart without parsing messages
+const (
+	ErrorCodeNone         = 0
+	ErrorCodeInternal     = 1000
+	ErrorCodeValidation   = 1001
+	ErrorCodeUnauthorized = 1002
+	ErrorCodeForbidden    = 1003
+	ErrorCodeNotFound     = 1004
+	ErrorCodeConflict     = 1005
+	ErrorCodeUpstream     = 1006
+	ErrorCodeInvalid      = 1007
+	ErrorCodeTimeout      = 1008
+	ErrorCodeUnavailable  = 1009
+	ErrorCodeRateLimited  = 1010
+	ErrorCodeGone         = 1011
+)
+
+// statusAndCode maps a domain error kind to its HTTP status and error code
+func statusAndCode(kind apperrors.Kind) (int, int) {
+	switch kind {
+	case apperrors.KindValidation:
+		return http.StatusBadRequest, ErrorCodeValidation
+	case apperrors.KindUnauthorized:
+		return http.StatusUnauthorized, ErrorCodeUnauthorized
+	case apperrors.KindForbidden:
+		return http.StatusForbidden, ErrorCodeForbidden
+	case apperrors.KindNotFound:
+		return http.StatusNotFound, ErrorCodeNotFound
+	case apperrors.KindConflict:
+		return http.StatusConflict, ErrorCodeConflict
+	case apperrors.KindUpstream:
+		return http.StatusBadGateway, ErrorCodeUpstream
+	case apperrors.KindInvalid:
+		return http.StatusUnprocessableEntity, ErrorCodeInvalid
+	case apperrors.KindTimeout:
+		return http.StatusGatewayTimeout, ErrorCodeTimeout
+	case apperrors.KindUnavailable:
+		return http.StatusServiceUnavailable, ErrorCodeUnavailable
+	case apperrors.KindRateLimited:
+		return http.StatusTooManyRequests, ErrorCodeRateLimited
+	case apperrors.KindGone:
+		return http.StatusGone, ErrorCodeGone
+	default:
+		return http.StatusInternalServerError, ErrorCodeInternal
+	}
+}
+
+// WriteJSON writes a response with the given status
+func WriteJSON(w http.ResponseWriter, status int, response *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+// WriteError writes err as a JSON Response with the status and error code of its kind.
+// Only domain error messages reach the client; anything else is logged and reported as an internal error.
+// Field errors of an invalid payload are listed in Response.Errors.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	kind := apperrors.KindOf(err)
+	status, code := statusAndCode(kind)
+
+	message := "Internal server error"
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) && kind != apperrors.KindInternal {
+		message = appErr.Message
+	}
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("request failed",
+			"kind", kind.String(), "status", status, "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+
+	WriteJSON(w, status, &Response{
+		Messages:  []string{message},
+		ErrorCode: code,
+		Errors:    apperrors.FieldsOf(err),
+	})
+}
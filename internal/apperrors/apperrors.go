@@ -0,0 +1,161 @@
+// Package apperrors defines the domain errors returned by dataaccess and handlers.
+// Each error has a Kind, which the api package maps to an HTTP status and error code,
+// and a Message that is safe to show to the client.
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kind classifies an error by how the client should treat it
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUpstream
+	KindInvalid
+	KindTimeout
+	KindUnavailable
+	KindRateLimited
+	KindGone
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindValidation:
+		return "validation"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindForbidden:
+		return "forbidden"
+	case KindNotFound:
+		return "not found"
+	case KindConflict:
+		return "conflict"
+	case KindUpstream:
+		return "upstream"
+	case KindInvalid:
+		return "invalid"
+	case KindTimeout:
+		return "timeout"
+	case KindUnavailable:
+		return "unavailable"
+	case KindRateLimited:
+		return "rate limited"
+	case KindGone:
+		return "gone"
+	default:
+		return "internal"
+	}
+}
+
+// FieldError describes why a single field of a request payload was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error. Err optionally holds the underlying cause, which is logged but not shown to clients.
+// Fields is only set on KindInvalid errors.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFound reports that the requested resource does not exist
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validation reports that the request is malformed or has invalid values
+func Validation(format string, args ...interface{}) error {
+	return &Error{Kind: KindValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// Unauthorized reports that the request is not authenticated
+func Unauthorized(format string, args ...interface{}) error {
+	return &Error{Kind: KindUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// Forbidden reports that the authenticated user may not perform the request
+func Forbidden(format string, args ...interface{}) error {
+	return &Error{Kind: KindForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict reports that the request clashes with existing data, such as a duplicate username
+func Conflict(format string, args ...interface{}) error {
+	return &Error{Kind: KindConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// Upstream reports that a service this one depends on, such as an identity provider, failed
+func Upstream(format string, args ...interface{}) error {
+	return &Error{Kind: KindUpstream, Message: fmt.Sprintf(format, args...)}
+}
+
+// RateLimited reports that the client has sent too many requests and should wait before retrying
+func RateLimited(format string, args ...interface{}) error {
+	return &Error{Kind: KindRateLimited, Message: fmt.Sprintf(format, args...)}
+}
+
+// Gone reports that the requested route or resource has been removed for good
+func Gone(format string, args ...interface{}) error {
+	return &Error{Kind: KindGone, Message: fmt.Sprintf(format, args...)}
+}
+
+// Invalid reports that a well-formed request payload has field values that were rejected.
+// The message summarises every field error for clients that only show messages.
+func Invalid(fields []FieldError) error {
+	summary := make([]string, 0, len(fields))
+	for _, field := range fields {
+		summary = append(summary, field.Field+" "+field.Message)
+	}
+	return &Error{Kind: KindInvalid, Message: "invalid request: " + strings.Join(summary, ", "), Fields: fields}
+}
+
+// Wrap returns a domain error of the given kind that keeps err as its cause
+func Wrap(kind Kind, err error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// KindOf returns the kind of the first domain error in err's chain, or KindInternal if there is none
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+// IsNotFound reports whether err is, or wraps, a NotFound error
+func IsNotFound(err error) bool {
+	return KindOf(err) == KindNotFound
+}
+
+// FieldsOf returns the field errors of the first domain error in err's chain
+func FieldsOf(err error) []FieldError {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
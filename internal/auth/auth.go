@@ -2,47 +2,46 @@ package auth
 
 import (
     "encoding/json"
+    "fmt"
     "net/http"
     "strconv"
-    "log"
-    "github.com/blobfish465/common-circle-web-forum/internal/database"
-    "github.com/blobfish465/common-circle-web-forum/internal/dataaccess/users"
-    "github.com/blobfish465/common-circle-web-forum/internal/models"
+    "github.com/blobfish465/common-circle-web-forum/internal/api"
+    "github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+    "github.com/blobfish465/common-circle-web-forum/internal/dto"
+    "github.com/blobfish465/common-circle-web-forum/internal/logging"
+    "github.com/blobfish465/common-circle-web-forum/internal/store"
     "github.com/blobfish465/common-circle-web-forum/internal/utils"
     "golang.org/x/crypto/bcrypt"
 )
 
 // Handles the neccessary authentication for user login
 func Login(w http.ResponseWriter, r *http.Request) {
-    var credentials models.User
-    err := json.NewDecoder(r.Body).Decode(&credentials)
+    credentials, err := api.Decode[dto.LoginRequest](r)
     if err != nil {
-        http.Error(w, "Invalid input", http.StatusBadRequest)
+        api.WriteError(w, r, err)
         return
     }
 
-    db, err := database.GetDB()
-    if err != nil {
-        http.Error(w, "Failed to connect to the database", http.StatusInternalServerError)
+    user, err := store.From(r.Context()).Users.GetByUsername(r.Context(), credentials.Username)
+    if apperrors.IsNotFound(err) {
+        api.WriteError(w, r, apperrors.Unauthorized("Invalid credentials"))
         return
     }
-
-    user, err := users.GetUserByUsername(db, credentials.Username)
     if err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        api.WriteError(w, r, err)
         return
     }
 
     // Check password here
     if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(credentials.Password)); err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        api.WriteError(w, r, apperrors.Unauthorized("Invalid credentials"))
         return
     }
 
-    log.Printf("User ID to encode in JWT: %d\n", user.ID)
+    logging.FromContext(r.Context()).Info("user logged in", "user_id", user.ID)
     token, err := utils.GenerateJWT(strconv.Itoa(user.ID))  // Convert int ID to string
     if err != nil {
-        http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+        api.WriteError(w, r, fmt.Errorf("failed to generate token: %w", err))
         return
     }
 
@@ -0,0 +1,564 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	// jwksRefreshInterval is the least time between fetches of a provider's key set, so
+	// that tokens with made up key IDs cannot make the server fetch it on every request
+	jwksRefreshInterval = time.Minute
+)
+
+// OIDCProvider holds the relying-party settings for one OpenID Connect provider.
+// Providers are set up from the configuration by ConfigureOIDC.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	// keysFetchedAt is when the key set was last fetched, and keysFetching is closed
+	// when the fetch in progress, if any, is done
+	keysFetchedAt time.Time
+	keysFetching  chan struct{}
+}
+
+// oidcDiscovery is the subset of the provider metadata document the login flow needs
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcState is signed into the state cookie so the callback can be matched to the login request
+type oidcState struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+// idTokenClaims are the ID token claims used to find or create the local user
+type idTokenClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+var (
+	oidcProviders         = map[string]*OIDCProvider{}
+	oidcPostLoginRedirect string
+	// oidcHTTPClient traces its requests and passes the trace on to the provider
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+)
+
+// ConfigureOIDC sets up the providers used for social login. postLoginRedirect is where
+// browser based logins are sent with their token; when empty, the token is returned as JSON.
+func ConfigureOIDC(providers map[string]config.OIDCProvider, postLoginRedirect string) {
+	oidcProviders = make(map[string]*OIDCProvider, len(providers))
+	for name, settings := range providers {
+		name = strings.ToLower(name)
+		oidcProviders[name] = &OIDCProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(settings.Issuer, "/"),
+			ClientID:     settings.ClientID,
+			ClientSecret: settings.ClientSecret,
+			RedirectURL:  settings.RedirectURL,
+			Scopes:       settings.Scopes,
+		}
+	}
+	oidcPostLoginRedirect = postLoginRedirect
+}
+
+// GetOIDCProvider returns the configured provider with the given name, or nil if there is none
+func GetOIDCProvider(name string) *OIDCProvider {
+	return oidcProviders[strings.ToLower(name)]
+}
+
+// HandleListOIDCProviders returns the names of the configured providers so the frontend can render login buttons
+func HandleListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"providers": names})
+}
+
+// HandleOIDCLogin starts the authorization code flow with PKCE by redirecting to the provider
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider := GetOIDCProvider(chi.URLParam(r, "provider"))
+	if provider == nil {
+		api.WriteError(w, r, apperrors.NotFound("Unknown login provider"))
+		return
+	}
+
+	discovery, err := provider.discover(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("OIDC discovery failed", "provider", provider.Name, "error", err)
+		api.WriteError(w, r, apperrors.Upstream("Login provider is unavailable"))
+		return
+	}
+
+	state := &oidcState{
+		Provider:     provider.Name,
+		State:        randomToken(),
+		Nonce:        randomToken(),
+		CodeVerifier: randomToken(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	signedState, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString(stateKey())
+	if err != nil {
+		api.WriteError(w, r, fmt.Errorf("failed to sign login state: %w", err))
+		return
+	}
+	http.SetCookie(w, stateCookie(r, signedState, int(oidcStateTTL.Seconds())))
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {provider.RedirectURL},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, discovery.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// HandleOIDCCallback completes the login: it exchanges the code, verifies the ID token,
+// links or creates the local user and returns a JWT the same way Login does.
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider := GetOIDCProvider(chi.URLParam(r, "provider"))
+	if provider == nil {
+		api.WriteError(w, r, apperrors.NotFound("Unknown login provider"))
+		return
+	}
+
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		api.WriteError(w, r, apperrors.Unauthorized("Login was not completed: %s", errParam))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		api.WriteError(w, r, apperrors.Validation("Missing login state"))
+		return
+	}
+	// The state is single use, so clear the cookie whatever the outcome
+	http.SetCookie(w, stateCookie(r, "", -1))
+
+	state := &oidcState{}
+	_, err = jwt.ParseWithClaims(cookie.Value, state, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return stateKey(), nil
+	})
+	if err != nil || state.Provider != provider.Name || state.State != r.URL.Query().Get("state") {
+		api.WriteError(w, r, apperrors.Validation("Invalid or expired login state"))
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		api.WriteError(w, r, apperrors.Validation("Missing authorization code"))
+		return
+	}
+
+	rawIDToken, err := provider.exchangeCode(r.Context(), code, state.CodeVerifier)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("OIDC code exchange failed", "provider", provider.Name, "error", err)
+		api.WriteError(w, r, apperrors.Upstream("Failed to complete login with provider"))
+		return
+	}
+
+	claims, err := provider.verifyIDToken(r.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("OIDC ID token rejected", "provider", provider.Name, "error", err)
+		api.WriteError(w, r, apperrors.Unauthorized("Invalid credentials"))
+		return
+	}
+
+	// The account and its identity are created together, so a failed link leaves no orphaned account
+	var user *models.User
+	err = store.From(r.Context()).WithTx(r.Context(), func(tx *store.Stores) error {
+		user, err = resolveOIDCUser(r.Context(), tx, provider.Name, claims)
+		return err
+	})
+	if err != nil {
+		api.WriteError(w, r, fmt.Errorf("failed to resolve %s user: %w", provider.Name, err))
+		return
+	}
+
+	token, err := utils.GenerateJWT(strconv.Itoa(user.ID))
+	if err != nil {
+		api.WriteError(w, r, fmt.Errorf("failed to generate token: %w", err))
+		return
+	}
+
+	// Browser based logins are handed back to the frontend with the token in the URL fragment
+	if redirect := oidcPostLoginRedirect; redirect != "" {
+		http.Redirect(w, r, redirect+"#token="+url.QueryEscape(token), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// stateKey signs the login state. It is derived from the JWT secret rather than being
+// the secret itself, so that a state cannot be passed off as an access token.
+func stateKey() []byte {
+	mac := hmac.New(sha256.New, utils.GetJWTSecret())
+	mac.Write([]byte("oidc-state"))
+	return mac.Sum(nil)
+}
+
+// stateCookie returns the cookie holding the login state, which is cleared with a
+// maxAge of -1
+func stateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode, // the callback is a top-level redirect from the provider
+	}
+}
+
+// resolveOIDCUser finds the user for an ID token. An already linked identity wins, then an
+// existing account is linked when both the provider and the account have verified the same
+// email, otherwise a new account is created.
+func resolveOIDCUser(ctx context.Context, stores *store.Stores, provider string, claims *idTokenClaims) (*models.User, error) {
+	identity, err := stores.Identities.GetByProviderSubject(ctx, provider, claims.Subject)
+	if err == nil {
+		return stores.Users.GetByID(ctx, identity.UserID)
+	}
+	if !apperrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, apperrors.Validation("provider %s did not return an email address", provider)
+	}
+
+	user, err := stores.Users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Linking hands the account to whoever controls the provider account, so both sides
+		// must have proven they own the email. An unverified local account may have been
+		// registered by someone else to take over the provider login once it is linked.
+		if !claims.EmailVerified || !user.EmailVerified {
+			return nil, apperrors.Conflict("an account with this email already exists; sign in with your password to link this provider")
+		}
+	case apperrors.IsNotFound(err):
+		user, err = createOIDCUser(ctx, stores, claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	_, err = stores.Identities.Create(ctx, &models.LinkedIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	logging.FromContext(ctx).Info("linked identity", "provider", provider, "user_id", user.ID)
+
+	return user, nil
+}
+
+// createOIDCUser creates an account for a first time social login. The account has no
+// password hash, so it can only sign in through its linked identities. Its email counts
+// as verified when the provider verified it.
+func createOIDCUser(ctx context.Context, stores *store.Stores, claims *idTokenClaims) (*models.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		_, err := stores.Users.GetByUsername(ctx, username)
+		if apperrors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if attempt == 5 {
+			return nil, fmt.Errorf("could not find a free username for %s", base)
+		}
+		username = base + "-" + randomToken()[:6]
+	}
+
+	user := &models.User{
+		Username:      username,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}
+	if err := stores.Users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// discover fetches and caches the provider metadata document
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, p.Issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and returns the raw ID token
+func (p *OIDCProvider) exchangeCode(ctx context.Context, code string, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("invalid token endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response did not contain an id_token")
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks the ID token signature against the provider's keys and validates
+// the issuer, audience, expiry and nonce.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*idTokenClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, discovery.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(discovery.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.ClientID, true) {
+		return nil, fmt.Errorf("token was not issued for client %s", p.ClientID)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	return claims, nil
+}
+
+// publicKey returns the signing key with the given key ID, refreshing the key set
+// when the ID is unknown so that provider key rotation is picked up. The key set is
+// fetched without holding the provider's lock, at most once per jwksRefreshInterval,
+// and callers that need it meanwhile wait for the fetch in progress.
+func (p *OIDCProvider) publicKey(ctx context.Context, jwksURI string, kid string) (*rsa.PublicKey, error) {
+	for {
+		p.mu.Lock()
+		if key, ok := p.keys[kid]; ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+		if fetching := p.keysFetching; fetching != nil {
+			p.mu.Unlock()
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("no signing key with ID %q", kid)
+		}
+		fetching := make(chan struct{})
+		p.keysFetching, p.keysFetchedAt = fetching, time.Now()
+		p.mu.Unlock()
+
+		keys, err := fetchJWKS(ctx, jwksURI)
+
+		p.mu.Lock()
+		if err == nil {
+			p.keys = keys
+		}
+		p.keysFetching = nil
+		close(fetching)
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchJWKS fetches the RSA keys of a JSON Web Key Set, by key ID
+func fetchJWKS(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %s: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %s: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches a URL and decodes its JSON body into v
+func getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", endpoint, err)
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s returned %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// randomToken returns a URL safe random string, used for state, nonce and the PKCE verifier
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
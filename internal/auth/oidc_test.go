@@ -0,0 +1,215 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/auth"
+	"github.com/blobfish465/common-circle-web-forum/internal/auth/oidctest"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/utils"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// oidcServers runs the API and an oidctest provider registered with it as "mock"
+type oidcServers struct {
+	api      *handlertest.Server
+	apiURL   string
+	provider *oidctest.Provider
+}
+
+func newOIDCServers(t *testing.T) *oidcServers {
+	t.Helper()
+
+	api := handlertest.New(t)
+	apiServer := httptest.NewServer(api)
+	t.Cleanup(apiServer.Close)
+
+	var provider *oidctest.Provider
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(providerServer.Close)
+
+	provider, err := oidctest.NewProvider(providerServer.URL, "common-circle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth.ConfigureOIDC(map[string]config.OIDCProvider{
+		"mock": {
+			Issuer:      providerServer.URL,
+			ClientID:    "common-circle",
+			RedirectURL: apiServer.URL + "/api/v1/auth/mock/callback",
+			Scopes:      []string{"openid", "email", "profile"},
+		},
+	}, "")
+	t.Cleanup(func() { auth.ConfigureOIDC(nil, "") })
+
+	return &oidcServers{api: api, apiURL: apiServer.URL, provider: provider}
+}
+
+// login signs in as identity through the whole redirect flow and returns the status of
+// the callback along with the token it returned, if any
+func (s *oidcServers) login(t *testing.T, identity oidctest.Identity) (int, string) {
+	t.Helper()
+
+	s.provider.SetIdentity(identity)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+
+	resp, err := client.Get(s.apiURL + "/api/v1/auth/mock/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode login response: %v", err)
+		}
+	}
+	return resp.StatusCode, body.Token
+}
+
+// me returns the user a token authenticates as
+func (s *oidcServers) me(t *testing.T, token string) dto.User {
+	t.Helper()
+
+	var me dto.User
+	handlertest.Decode(t, s.api.Do(http.MethodGet, "/api/v1/me", token, nil), http.StatusOK, &me)
+	return me
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	servers := newOIDCServers(t)
+	identity := oidctest.Identity{Subject: "subject-1", Email: "new@example.com", EmailVerified: true, PreferredUsername: "newbie"}
+
+	status, token := servers.login(t, identity)
+	if status != http.StatusOK {
+		t.Fatalf("login status = %d, want 200", status)
+	}
+	me := servers.me(t, token)
+	if me.Username != "newbie" || me.Email != "new@example.com" || !me.EmailVerified {
+		t.Errorf("user = %+v, want newbie with the verified provider email", me)
+	}
+
+	// Signing in again finds the linked account
+	status, token = servers.login(t, identity)
+	if status != http.StatusOK {
+		t.Fatalf("second login status = %d, want 200", status)
+	}
+	if again := servers.me(t, token); again.ID != me.ID {
+		t.Errorf("second login signed in as user %d, want %d", again.ID, me.ID)
+	}
+}
+
+func TestOIDCLoginLinksExistingAccount(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name             string
+		localVerified    bool
+		providerVerified bool
+		wantStatus       int
+	}{
+		{"both verified", true, true, http.StatusOK},
+		// Someone may have registered the address to take over the provider account
+		{"local email unverified", false, true, http.StatusConflict},
+		{"provider email unverified", true, false, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newOIDCServers(t)
+			stores := servers.api.DB.Stores()
+			local := models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash", EmailVerified: tt.localVerified}
+			if err := stores.Users.Create(ctx, &local); err != nil {
+				t.Fatal(err)
+			}
+
+			status, token := servers.login(t, oidctest.Identity{
+				Subject:           "subject-1",
+				Email:             "alice@example.com",
+				EmailVerified:     tt.providerVerified,
+				PreferredUsername: "alice-oidc",
+			})
+			if status != tt.wantStatus {
+				t.Fatalf("login status = %d, want %d", status, tt.wantStatus)
+			}
+
+			_, err := stores.Identities.GetByProviderSubject(ctx, "mock", "subject-1")
+			if tt.wantStatus != http.StatusOK {
+				if err == nil {
+					t.Error("identity was linked although the login was refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identity was not linked: %v", err)
+			}
+			if me := servers.me(t, token); me.ID != local.ID {
+				t.Errorf("login signed in as user %d, want the existing account %d", me.ID, local.ID)
+			}
+		})
+	}
+}
+
+func TestOIDCStateIsNotAnAccessToken(t *testing.T) {
+	servers := newOIDCServers(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(servers.apiURL + "/api/v1/auth/mock/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var state string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "oidc_state" {
+			state = cookie.Value
+		}
+	}
+	if state == "" {
+		t.Fatal("login did not set the state cookie")
+	}
+
+	// Access tokens are checked against the JWT secret, which must not verify the state
+	_, err = jwt.Parse(state, func(*jwt.Token) (interface{}, error) { return utils.GetJWTSecret(), nil })
+	if !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Errorf("verifying the state with the JWT secret returned %v, want an invalid signature", err)
+	}
+}
+
+func TestOIDCCallbackClearsStateCookie(t *testing.T) {
+	servers := newOIDCServers(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/mock/callback?state=guess&code=guess", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.AddCookie(&http.Cookie{Name: "oidc_state", Value: "forged"})
+	rec := httptest.NewRecorder()
+	servers.api.ServeHTTP(rec, req)
+
+	handlertest.Decode(t, rec, http.StatusBadRequest, nil)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "oidc_state" {
+		t.Fatalf("cookies = %v, want the state cookie cleared", cookies)
+	}
+	// The cookie is cleared with the attributes it was set with
+	if cleared := cookies[0]; cleared.MaxAge >= 0 || !cleared.Secure || !cleared.HttpOnly || cleared.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cleared cookie = %+v, want it expired, Secure, HttpOnly and SameSite=Lax", cleared)
+	}
+}
@@ -0,0 +1,121 @@
+package badges
+
+import (
+	"context"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+// EventType identifies something a user did that may earn them a badge
+type EventType string
+
+const (
+	ThreadCreated  EventType = "thread_created"
+	CommentCreated EventType = "comment_created"
+)
+
+// Event is emitted by the handlers after a user's action has been saved
+type Event struct {
+	Type   EventType
+	UserID int
+}
+
+// Rule awards its badge to a user once Earned returns true for their activity.
+// Rules are only evaluated for the events they list.
+type Rule struct {
+	Badge  models.Badge
+	Events []EventType
+	Earned func(stats *models.ActivityStats) bool
+}
+
+// rules is the badge catalog. Badge codes are stored with each award, so they must never change.
+var rules = []Rule{
+	{
+		Badge:  models.Badge{Code: "first_thread", Name: "Conversation Starter", Description: "Started your first thread"},
+		Events: []EventType{ThreadCreated},
+		Earned: func(stats *models.ActivityStats) bool { return stats.ThreadCount >= 1 },
+	},
+	{
+		Badge:  models.Badge{Code: "ten_threads", Name: "Regular Host", Description: "Started 10 threads"},
+		Events: []EventType{ThreadCreated},
+		Earned: func(stats *models.ActivityStats) bool { return stats.ThreadCount >= 10 },
+	},
+	{
+		Badge:  models.Badge{Code: "first_comment", Name: "Icebreaker", Description: "Posted your first comment"},
+		Events: []EventType{CommentCreated},
+		Earned: func(stats *models.ActivityStats) bool { return stats.CommentCount >= 1 },
+	},
+	{
+		Badge:  models.Badge{Code: "hundred_comments", Name: "Chatterbox", Description: "Posted 100 comments"},
+		Events: []EventType{CommentCreated},
+		Earned: func(stats *models.ActivityStats) bool { return stats.CommentCount >= 100 },
+	},
+	{
+		Badge:  models.Badge{Code: "one_year_member", Name: "Old Friend", Description: "Took part in the forum after being a member for a year"},
+		Events: []EventType{ThreadCreated, CommentCreated},
+		Earned: func(stats *models.ActivityStats) bool { return stats.MemberDays >= 365 },
+	},
+}
+
+// Catalog returns every badge that can be earned
+func Catalog() []models.Badge {
+	catalog := make([]models.Badge, 0, len(rules))
+	for _, rule := range rules {
+		catalog = append(catalog, rule.Badge)
+	}
+	return catalog
+}
+
+// Emit evaluates the rules triggered by an event and awards any badges the user has now earned.
+// Awards are idempotent, so emitting the same event twice is harmless.
+func Emit(ctx context.Context, awards store.BadgeStore, event Event) error {
+	var triggered []Rule
+	for _, rule := range rules {
+		for _, eventType := range rule.Events {
+			if eventType == event.Type {
+				triggered = append(triggered, rule)
+				break
+			}
+		}
+	}
+	if len(triggered) == 0 {
+		return nil
+	}
+
+	stats, err := awards.GetActivityStats(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range triggered {
+		if !rule.Earned(stats) {
+			continue
+		}
+		awarded, err := awards.Award(ctx, event.UserID, rule.Badge.Code)
+		if err != nil {
+			return err
+		}
+		if awarded {
+			logging.FromContext(ctx).Info("badge awarded", "badge", rule.Badge.Code, "user_id", event.UserID)
+		}
+	}
+	return nil
+}
+
+// ListForUser returns the badges a user has been awarded, in catalog order
+func ListForUser(ctx context.Context, awards store.BadgeStore, userID int) ([]models.UserBadge, error) {
+	awarded, err := awards.ListAwarded(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	userBadges := []models.UserBadge{}
+	for _, rule := range rules {
+		if awardedAt, ok := awarded[rule.Badge.Code]; ok {
+			userBadges = append(userBadges, models.UserBadge{Badge: rule.Badge, AwardedAt: awardedAt})
+		}
+	}
+	return userBadges, nil
+}
@@ -0,0 +1,219 @@
+// Package config loads the server's settings into a typed, validated Config. Each setting
+// is taken from the first of these that has it:
+//
+//  1. the environment
+//  2. a .env file in the working directory
+//  3. an optional YAML (.yaml, .yml) or TOML (.toml) file, named by -config or CONFIG_FILE
+//  4. its default
+//
+// Settings are named by their environment variable, e.g. PORT, and in the config file by
+// their section and key, e.g. server.port.
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	API        API        `yaml:"api" toml:"api"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	CORS       CORS       `yaml:"cors" toml:"cors"`
+	Mail       Mail       `yaml:"mail" toml:"mail"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Reputation Reputation `yaml:"reputation" toml:"reputation"`
+	Tracing    Tracing    `yaml:"tracing" toml:"tracing"`
+	Metrics    Metrics    `yaml:"metrics" toml:"metrics"`
+	RateLimit  RateLimit  `yaml:"rate_limit" toml:"rate_limit"`
+	AntiSpam   AntiSpam   `yaml:"anti_spam" toml:"anti_spam"`
+
+	// OIDC holds the OpenID Connect providers used for social login, by lowercase name.
+	// In the environment they are listed in OIDC_PROVIDERS, and each is configured with
+	// variables prefixed OIDC_<NAME>_, e.g. OIDC_GOOGLE_ISSUER.
+	OIDC map[string]OIDCProvider `yaml:"oidc" toml:"oidc"`
+
+	entries []Entry
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port int `yaml:"port" toml:"port" env:"PORT" default:"8000"`
+	// ReadHeaderTimeout bounds reading a request's headers, and ReadTimeout the whole request
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"5s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s"`
+	// WriteTimeout bounds handling a request and writing its response
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	// IdleTimeout is how long a keep-alive connection waits for its next request
+	IdleTimeout    time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"2m"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" default:"1048576"`
+	// ShutdownTimeout is how long in-flight requests get to finish once the server is told to stop
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"20s"`
+}
+
+// API configures the versions of the API
+type API struct {
+	// LegacySunset is when the unversioned aliases of the /api/v1 routes are removed. Until
+	// then they are served with Deprecation and Sunset headers, and answered with 410 Gone after.
+	LegacySunset time.Time `yaml:"legacy_sunset" toml:"legacy_sunset" env:"API_LEGACY_SUNSET" default:"2027-04-19T00:00:00Z"`
+}
+
+// Database configures the Postgres connection
+type Database struct {
+	URL string `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"url"`
+	// QueryTimeout bounds each query; zero means no limit
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout" env:"DB_QUERY_TIMEOUT" default:"5s"`
+}
+
+// Auth configures authentication
+type Auth struct {
+	JWTSecret string `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	// PostLoginRedirect is where browser based social logins are sent with their token.
+	// When empty, the token is returned as JSON.
+	PostLoginRedirect string `yaml:"post_login_redirect" toml:"post_login_redirect" env:"OIDC_POST_LOGIN_REDIRECT"`
+}
+
+// CORS configures which browser origins may call the API
+type CORS struct {
+	// AllowedOrigins are origins like https://example.com. One may be * to allow any origin,
+	// and an origin may start its host with *. to allow every subdomain, e.g.
+	// https://*.netlify.app.
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" default:"https://unique-brioche-acdf26.netlify.app"`
+	AllowedMethods []string `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE,OPTIONS"`
+	AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Content-Type,Authorization,X-Request-ID"`
+	// MaxAge is how long browsers may cache a preflight response; zero leaves it to the browser
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE" default:"10m"`
+}
+
+// Mail configures outgoing email. Without an SMTP host, mail is logged instead of sent.
+type Mail struct {
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT" default:"587"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM" default:"no-reply@commoncircle.local"`
+	// VerificationURL is the frontend page that confirms a new email address
+	VerificationURL string `yaml:"verification_url" toml:"verification_url" env:"EMAIL_VERIFICATION_URL" default:"http://localhost:3000/verify-email"`
+}
+
+// Log configures logging
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" default:"info"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" default:"json"`
+}
+
+// Reputation configures the nightly reputation reconciliation
+type Reputation struct {
+	ReconcileHour int `yaml:"reconcile_hour" toml:"reconcile_hour" env:"REPUTATION_RECONCILE_HOUR" default:"3"`
+}
+
+// Tracing configures OpenTelemetry tracing. The settings use the standard OTEL_ names.
+type Tracing struct {
+	// Exporter is otlp to send spans to a collector, or none to disable tracing. Incoming
+	// traceparent headers are passed on either way.
+	Exporter string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none"`
+	// Endpoint is the base URL of the collector's OTLP/HTTP receiver; http:// sends spans
+	// without TLS, as to a local collector
+	Endpoint    string `yaml:"endpoint" toml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"http://localhost:4318"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME" default:"common-circle-api"`
+	// SampleRatio is the share of traces started here that are recorded, from 0 to 1.
+	// Requests that arrive with a sampled trace are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG" default:"1"`
+}
+
+// Metrics configures the Prometheus metrics served on /metrics. They are not served unless
+// Addr or Token is set, as they describe the server to anyone who can read them.
+type Metrics struct {
+	// Addr is an address, e.g. :9090, to serve /metrics on instead of the API's port, so it
+	// can be kept off the public network
+	Addr string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	// Token is a bearer token scrapers must send to read /metrics
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// RateLimit configures how many requests each user, or each client IP when not signed in,
+// may make to each group of routes
+type RateLimit struct {
+	// Store keeps the token buckets: memory for a single instance, postgres to share them
+	// between instances, or none to disable rate limiting
+	Store string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" default:"memory"`
+	// TrustProxy takes the client IP from the last X-Forwarded-For address, as set by the
+	// load balancer in front of the server. Leave it off when clients connect directly, as
+	// they could otherwise pick their own IP.
+	TrustProxy bool `yaml:"trust_proxy" toml:"trust_proxy" env:"RATE_LIMIT_TRUST_PROXY"`
+	// Auth covers logging in and signing up, Write the routes that change data and Read
+	// the rest
+	Auth  Rate `yaml:"auth" toml:"auth" env:"RATE_LIMIT_AUTH" default:"10/1m"`
+	Write Rate `yaml:"write" toml:"write" env:"RATE_LIMIT_WRITE" default:"30/1m"`
+	Read  Rate `yaml:"read" toml:"read" env:"RATE_LIMIT_READ" default:"300/1m"`
+}
+
+// AntiSpam configures the rules new threads and comments must pass. A rule set to 0 is off.
+type AntiSpam struct {
+	// MinPostInterval is how long every user must wait between posts
+	MinPostInterval time.Duration `yaml:"min_post_interval" toml:"min_post_interval" env:"SPAM_MIN_POST_INTERVAL" default:"15s"`
+	// NewAccountDays is how many days an account counts as new, during which it may make at
+	// most NewAccountDailyPosts posts in any 24 hours, each with at most NewAccountMaxLinks links
+	NewAccountDays       int `yaml:"new_account_days" toml:"new_account_days" env:"SPAM_NEW_ACCOUNT_DAYS" default:"3"`
+	NewAccountDailyPosts int `yaml:"new_account_daily_posts" toml:"new_account_daily_posts" env:"SPAM_NEW_ACCOUNT_DAILY_POSTS" default:"10"`
+	NewAccountMaxLinks   int `yaml:"new_account_max_links" toml:"new_account_max_links" env:"SPAM_NEW_ACCOUNT_MAX_LINKS" default:"2"`
+	// DuplicateWindow is how long a user may not post the same content again
+	DuplicateWindow time.Duration `yaml:"duplicate_window" toml:"duplicate_window" env:"SPAM_DUPLICATE_WINDOW" default:"24h"`
+}
+
+// Rate allows a burst of Requests, refilled evenly over Per. It is written as
+// requests/period, e.g. 10/1m.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// UnmarshalText parses a rate written as requests/period
+func (r *Rate) UnmarshalText(text []byte) error {
+	requests, per, ok := strings.Cut(string(text), "/")
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if !ok || err != nil {
+		return fmt.Errorf("invalid rate %q, e.g. 10/1m", text)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q, e.g. 10/1m", text)
+	}
+	r.Requests, r.Per = n, d
+	return nil
+}
+
+func (r Rate) String() string {
+	return strconv.Itoa(r.Requests) + "/" + r.Per.String()
+}
+
+// OIDCProvider holds the relying party settings for one OpenID Connect provider. Its
+// environment variables are prefixed with OIDC_<NAME>_.
+type OIDCProvider struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer" env:"ISSUER"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"SCOPES" default:"openid,email,profile"`
+}
+
+// Entry describes the effective value of one setting, for Print
+type Entry struct {
+	// Name is the setting's environment variable
+	Name string
+	// Key is the setting's key in the config file
+	Key string
+	// Value is the setting's value, with secrets masked
+	Value string
+	// Source is where the value came from: env, .env, the config file's path or default
+	Source string
+}
+
+// Entries lists every setting with its effective value, in the order of Config's fields
+func (c *Config) Entries() []Entry {
+	return c.entries
+}
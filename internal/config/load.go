@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Options says where Load looks for settings besides the environment
+type Options struct {
+	// File is the YAML or TOML config file. When empty, CONFIG_FILE names it, if set.
+	File string
+	// EnvFile is the dotenv file, .env by default. It is skipped if it does not exist.
+	EnvFile string
+}
+
+// Error lists everything wrong with the configuration, so it can all be fixed at once
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// masked replaces secrets in Entry values
+const masked = "********"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the configuration and validates it. Any problems are reported together in an
+// *Error, along with the configuration as loaded so that it can still be printed.
+func Load(opts Options) (*Config, error) {
+	l := &loader{}
+
+	envFile := opts.EnvFile
+	if envFile == "" {
+		envFile = ".env"
+	}
+	dotenv, err := godotenv.Read(envFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", envFile, err)
+	}
+	l.dotenv = dotenv
+
+	var file Config
+	l.file = opts.File
+	if l.file == "" {
+		l.file, _, _ = l.lookup("CONFIG_FILE")
+	}
+	if l.file != "" {
+		if l.inFile, err = decodeFile(l.file, &file); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{}
+	l.fill(reflect.ValueOf(cfg).Elem(), reflect.ValueOf(file), "", "")
+	l.fillOIDC(cfg, file.OIDC)
+	cfg.entries = l.entries
+
+	l.validate(cfg)
+	if len(l.problems) > 0 {
+		return cfg, &Error{Problems: l.problems}
+	}
+	return cfg, nil
+}
+
+// decodeFile reads a YAML or TOML config file, rejecting keys that are not settings. It
+// returns the keys the file sets, in lowercase, so that settings it sets to their zero
+// value can be told apart from those it leaves out.
+func decodeFile(path string, cfg *Config) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	keys := make(map[string]bool)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		yamlKeys(&root, "", keys)
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("invalid config file %s: unknown key %s", path, undecoded[0])
+		}
+		for _, key := range meta.Keys() {
+			keys[strings.ToLower(strings.Join(key, "."))] = true
+		}
+	default:
+		return nil, fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	return keys, nil
+}
+
+// yamlKeys adds the dotted keys set in a YAML node to keys. Keys set to null count as unset.
+func yamlKeys(node *yaml.Node, prefix string, keys map[string]bool) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			yamlKeys(child, prefix, keys)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Tag == "!!null" {
+				continue
+			}
+			name := prefix + strings.ToLower(key.Value)
+			keys[name] = true
+			yamlKeys(value, name+".", keys)
+		}
+	}
+}
+
+type loader struct {
+	dotenv map[string]string
+	file   string
+	// inFile holds the keys set in the config file, in lowercase
+	inFile   map[string]bool
+	entries  []Entry
+	problems []string
+}
+
+// lookup returns a setting from the environment or the .env file, and which it came from
+func (l *loader) lookup(name string) (string, string, bool) {
+	if value := os.Getenv(name); value != "" {
+		return value, "env", true
+	}
+	if value := l.dotenv[name]; value != "" {
+		return value, ".env", true
+	}
+	return "", "", false
+}
+
+// fill sets the settings in dst, a struct of the Config, from the environment, the
+// matching struct decoded from the config file and the defaults in the field tags
+func (l *loader) fill(dst, file reflect.Value, envPrefix, keyPrefix string) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := keyPrefix + field.Tag.Get("yaml")
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct {
+				l.fill(dst.Field(i), file.Field(i), envPrefix, key+".")
+			}
+			continue
+		}
+		l.setting(dst.Field(i), file.Field(i), field, envPrefix+name, key)
+	}
+}
+
+func (l *loader) setting(dst, file reflect.Value, field reflect.StructField, name, key string) {
+	raw, hasRaw := field.Tag.Lookup("default")
+	source := "default"
+	if l.inFile[strings.ToLower(key)] {
+		dst.Set(file)
+		source = l.file
+		hasRaw = false
+	}
+	if value, from, ok := l.lookup(name); ok {
+		raw, hasRaw, source = value, true, from
+	}
+	if hasRaw {
+		if err := parse(dst, raw); err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s (%s): %v", name, key, err))
+		}
+	}
+
+	l.entries = append(l.entries, Entry{
+		Name:   name,
+		Key:    key,
+		Value:  mask(format(dst), field.Tag.Get("secret")),
+		Source: source,
+	})
+}
+
+// fillOIDC configures the providers named in OIDC_PROVIDERS or in the config file
+func (l *loader) fillOIDC(cfg *Config, file map[string]OIDCProvider) {
+	fileProviders := make(map[string]OIDCProvider)
+	names := make(map[string]bool)
+	for name, provider := range file {
+		name = strings.ToLower(name)
+		fileProviders[name] = provider
+		names[name] = true
+	}
+
+	listed, source, _ := l.lookup("OIDC_PROVIDERS")
+	for _, name := range splitList(listed) {
+		names[strings.ToLower(name)] = true
+	}
+	if source == "" {
+		source = "default"
+		if len(file) > 0 {
+			source = l.file
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	l.entries = append(l.entries, Entry{Name: "OIDC_PROVIDERS", Key: "oidc", Value: strings.Join(sorted, ","), Source: source})
+
+	cfg.OIDC = make(map[string]OIDCProvider, len(sorted))
+	for _, name := range sorted {
+		var provider OIDCProvider
+		l.fill(reflect.ValueOf(&provider).Elem(), reflect.ValueOf(fileProviders[name]),
+			"OIDC_"+strings.ToUpper(name)+"_", "oidc."+name+".")
+		provider.Issuer = strings.TrimSuffix(provider.Issuer, "/")
+		cfg.OIDC[name] = provider
+	}
+}
+
+// parse sets dst from a string setting
+func parse(dst reflect.Value, raw string) error {
+	if unmarshaler, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+	if dst.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 5s or 1m", raw)
+		}
+		dst.SetInt(int64(d))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		dst.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		dst.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		dst.SetBool(b)
+	case reflect.Slice:
+		dst.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported setting type %s", dst.Type())
+	}
+	return nil
+}
+
+// splitList splits a list separated by commas or whitespace
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// format returns a setting as it would be written in the environment
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// mask hides a secret value. URLs keep everything but their password.
+func mask(value string, secret string) string {
+	if value == "" || secret == "" {
+		return value
+	}
+	if secret == "url" {
+		if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), masked)
+			}
+			if query := u.Query(); query.Has("password") {
+				query.Set("password", masked)
+				u.RawQuery = query.Encode()
+			}
+			// URL encodes the asterisks, which would make the mask harder to read
+			return strings.ReplaceAll(u.String(), url.QueryEscape(masked), masked)
+		}
+	}
+	return masked
+}
@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+)
+
+// load writes the config file and .env into a temporary directory and loads them. The
+// configuration is returned even when it is invalid, as these tests only look at values.
+func load(t *testing.T, name string, file string, dotenv string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	opts := config.Options{EnvFile: filepath.Join(dir, ".env")}
+	if dotenv != "" {
+		if err := os.WriteFile(opts.EnvFile, []byte(dotenv), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if file != "" {
+		opts.File = filepath.Join(dir, name)
+		if err := os.WriteFile(opts.File, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := config.Load(opts)
+	var invalid *config.Error
+	if err != nil && !errors.As(err, &invalid) {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// source returns where the setting named by its environment variable came from
+func source(cfg *config.Config, name string) string {
+	for _, entry := range cfg.Entries() {
+		if entry.Name == name {
+			return entry.Source
+		}
+	}
+	return ""
+}
+
+func TestFileOverridesDefaultsWithZeroValues(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+anti_spam:
+  min_post_interval: 0s
+  new_account_max_links: 0
+tracing:
+  endpoint: ""
+  sample_ratio: 0
+rate_limit:
+  trust_proxy: false
+`,
+		"config.toml": `
+[anti_spam]
+min_post_interval = "0s"
+new_account_max_links = 0
+
+[tracing]
+endpoint = ""
+sample_ratio = 0.0
+
+[rate_limit]
+trust_proxy = false
+`,
+	}
+	for name, file := range files {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{"SPAM_MIN_POST_INTERVAL", "SPAM_NEW_ACCOUNT_MAX_LINKS", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_TRACES_SAMPLER_ARG", "RATE_LIMIT_TRUST_PROXY"} {
+				t.Setenv(env, "")
+			}
+			cfg := load(t, name, file, "")
+
+			if cfg.AntiSpam.MinPostInterval != 0 || cfg.AntiSpam.NewAccountMaxLinks != 0 {
+				t.Errorf("anti_spam = %+v, want no interval and no links from the file", cfg.AntiSpam)
+			}
+			if cfg.Tracing.Endpoint != "" || cfg.Tracing.SampleRatio != 0 {
+				t.Errorf("tracing = %+v, want no endpoint and a ratio of 0 from the file", cfg.Tracing)
+			}
+			for _, env := range []string{"SPAM_MIN_POST_INTERVAL", "OTEL_TRACES_SAMPLER_ARG", "RATE_LIMIT_TRUST_PROXY"} {
+				if got := source(cfg, env); filepath.Base(got) != name {
+					t.Errorf("source of %s = %q, want the config file", env, got)
+				}
+			}
+			// Settings the file leaves out keep their defaults
+			if cfg.AntiSpam.NewAccountDays != 3 || source(cfg, "SPAM_NEW_ACCOUNT_DAYS") != "default" {
+				t.Errorf("new account days = %d from %s, want the default 3", cfg.AntiSpam.NewAccountDays, source(cfg, "SPAM_NEW_ACCOUNT_DAYS"))
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	const file = "server:\n  port: 9000\n  read_timeout: 20s\n"
+
+	tests := []struct {
+		name       string
+		env        string
+		dotenv     string
+		file       string
+		wantPort   int
+		wantSource string
+	}{
+		{"default", "", "", "", 8000, "default"},
+		{"file over default", "", "", file, 9000, "config.yaml"},
+		{".env over file", "", "PORT=9100\n", file, 9100, ".env"},
+		{"env over .env and file", "9200", "PORT=9100\n", file, 9200, "env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PORT", tt.env)
+			t.Setenv("SERVER_READ_TIMEOUT", "")
+			cfg := load(t, "config.yaml", tt.file, tt.dotenv)
+
+			if cfg.Server.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", cfg.Server.Port, tt.wantPort)
+			}
+			if got := source(cfg, "PORT"); filepath.Base(got) != tt.wantSource {
+				t.Errorf("source of PORT = %q, want %s", got, tt.wantSource)
+			}
+		})
+	}
+
+	// Each setting is resolved on its own, so the file still sets what the environment does not
+	t.Setenv("PORT", "9200")
+	t.Setenv("SERVER_READ_TIMEOUT", "")
+	cfg := load(t, "config.yaml", file, "")
+	if cfg.Server.Port != 9200 || cfg.Server.ReadTimeout != 20*time.Second {
+		t.Errorf("server = %+v, want the port from the environment and the read timeout from the file", cfg.Server)
+	}
+}
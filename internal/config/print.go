@@ -0,0 +1,21 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Print writes every setting's effective value and where it came from, with secrets masked
+func Print(w io.Writer, cfg *Config) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tKEY\tVALUE\tSOURCE")
+	for _, entry := range cfg.Entries() {
+		value := entry.Value
+		if value == "" {
+			value = "(unset)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Name, entry.Key, value, entry.Source)
+	}
+	return tw.Flush()
+}
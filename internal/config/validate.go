@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// validate records a problem for every setting that is missing or out of range
+func (l *loader) validate(cfg *Config) {
+	problem := func(name, key, format string, args ...interface{}) {
+		l.problems = append(l.problems, fmt.Sprintf("%s (%s) ", name, key)+fmt.Sprintf(format, args...))
+	}
+
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		problem("PORT", "server.port", "must be between 1 and 65535, got %d", cfg.Server.Port)
+	}
+	for _, timeout := range []struct {
+		name, key string
+		value     time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", "server.read_header_timeout", cfg.Server.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", "server.read_timeout", cfg.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", "server.write_timeout", cfg.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", "server.idle_timeout", cfg.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", "server.shutdown_timeout", cfg.Server.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			problem(timeout.name, timeout.key, "must be positive")
+		}
+	}
+	if cfg.Server.MaxHeaderBytes < 1024 {
+		problem("SERVER_MAX_HEADER_BYTES", "server.max_header_bytes", "must be at least 1024, got %d", cfg.Server.MaxHeaderBytes)
+	}
+
+	if cfg.Database.URL == "" {
+		problem("DATABASE_URL", "database.url", "is required")
+	}
+	if cfg.Database.QueryTimeout < 0 {
+		problem("DB_QUERY_TIMEOUT", "database.query_timeout", "cannot be negative")
+	}
+
+	if cfg.Auth.JWTSecret == "" {
+		problem("JWT_SECRET", "auth.jwt_secret", "is required")
+	}
+	if cfg.Auth.PostLoginRedirect != "" && !isAbsoluteURL(cfg.Auth.PostLoginRedirect) {
+		problem("OIDC_POST_LOGIN_REDIRECT", "auth.post_login_redirect", "must be an absolute URL")
+	}
+
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if origin != "*" && !isOriginPattern(origin) {
+			problem("CORS_ALLOWED_ORIGINS", "cors.allowed_origins", "has %q, which is not an origin like https://example.com or https://*.example.com", origin)
+		}
+	}
+	for _, method := range cfg.CORS.AllowedMethods {
+		if !httpMethods[method] {
+			problem("CORS_ALLOWED_METHODS", "cors.allowed_methods", "has %q, which is not an upper case HTTP method such as PATCH", method)
+		}
+	}
+	for _, header := range cfg.CORS.AllowedHeaders {
+		if header != "*" && !isHeaderName(header) {
+			problem("CORS_ALLOWED_HEADERS", "cors.allowed_headers", "has %q, which is not a header name", header)
+		}
+	}
+	if cfg.CORS.MaxAge < 0 {
+		problem("CORS_MAX_AGE", "cors.max_age", "cannot be negative")
+	}
+
+	if cfg.Mail.SMTPPort < 1 || cfg.Mail.SMTPPort > 65535 {
+		problem("SMTP_PORT", "mail.smtp_port", "must be between 1 and 65535, got %d", cfg.Mail.SMTPPort)
+	}
+	if !isAbsoluteURL(cfg.Mail.VerificationURL) {
+		problem("EMAIL_VERIFICATION_URL", "mail.verification_url", "must be an absolute URL")
+	}
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		problem("LOG_LEVEL", "log.level", "must be debug, info, warn or error, got %q", cfg.Log.Level)
+	}
+	switch strings.ToLower(cfg.Log.Format) {
+	case "json", "text":
+	default:
+		problem("LOG_FORMAT", "log.format", "must be json or text, got %q", cfg.Log.Format)
+	}
+
+	if cfg.Reputation.ReconcileHour < 0 || cfg.Reputation.ReconcileHour > 23 {
+		problem("REPUTATION_RECONCILE_HOUR", "reputation.reconcile_hour", "must be between 0 and 23, got %d", cfg.Reputation.ReconcileHour)
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		if !isAbsoluteURL(cfg.Tracing.Endpoint) {
+			problem("OTEL_EXPORTER_OTLP_ENDPOINT", "tracing.endpoint", "must be an absolute URL")
+		}
+		if cfg.Tracing.ServiceName == "" {
+			problem("OTEL_SERVICE_NAME", "tracing.service_name", "is required")
+		}
+	default:
+		problem("OTEL_TRACES_EXPORTER", "tracing.exporter", "must be otlp or none, got %q", cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problem("OTEL_TRACES_SAMPLER_ARG", "tracing.sample_ratio", "must be between 0 and 1, got %g", cfg.Tracing.SampleRatio)
+	}
+
+	if cfg.Metrics.Addr != "" {
+		if _, port, err := net.SplitHostPort(cfg.Metrics.Addr); err != nil || port == "" {
+			problem("METRICS_ADDR", "metrics.addr", "must be an address like :9090, got %q", cfg.Metrics.Addr)
+		}
+	}
+
+	switch cfg.RateLimit.Store {
+	case "memory", "postgres", "none":
+	default:
+		problem("RATE_LIMIT_STORE", "rate_limit.store", "must be memory, postgres or none, got %q", cfg.RateLimit.Store)
+	}
+	for _, rate := range []struct {
+		name, key string
+		value     Rate
+	}{
+		{"RATE_LIMIT_AUTH", "rate_limit.auth", cfg.RateLimit.Auth},
+		{"RATE_LIMIT_WRITE", "rate_limit.write", cfg.RateLimit.Write},
+		{"RATE_LIMIT_READ", "rate_limit.read", cfg.RateLimit.Read},
+	} {
+		if rate.value == (Rate{}) {
+			continue // already reported as unparseable
+		}
+		// Idle buckets are deleted after a day, by which time every one has refilled
+		if rate.value.Requests < 1 || rate.value.Per <= 0 || rate.value.Per > 24*time.Hour {
+			problem(rate.name, rate.key, "must allow at least 1 request per period of up to 24h, got %s", rate.value)
+		}
+	}
+
+	if cfg.AntiSpam.MinPostInterval < 0 {
+		problem("SPAM_MIN_POST_INTERVAL", "anti_spam.min_post_interval", "cannot be negative")
+	}
+	if cfg.AntiSpam.NewAccountDays < 0 {
+		problem("SPAM_NEW_ACCOUNT_DAYS", "anti_spam.new_account_days", "cannot be negative")
+	}
+	if cfg.AntiSpam.NewAccountDailyPosts < 0 {
+		problem("SPAM_NEW_ACCOUNT_DAILY_POSTS", "anti_spam.new_account_daily_posts", "cannot be negative")
+	}
+	if cfg.AntiSpam.NewAccountMaxLinks < 0 {
+		problem("SPAM_NEW_ACCOUNT_MAX_LINKS", "anti_spam.new_account_max_links", "cannot be negative")
+	}
+	if cfg.AntiSpam.DuplicateWindow < 0 {
+		problem("SPAM_DUPLICATE_WINDOW", "anti_spam.duplicate_window", "cannot be negative")
+	}
+
+	for name, provider := range cfg.OIDC {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		if !isAbsoluteURL(provider.Issuer) {
+			problem(prefix+"ISSUER", "oidc."+name+".issuer", "must be an absolute URL")
+		}
+		if provider.ClientID == "" {
+			problem(prefix+"CLIENT_ID", "oidc."+name+".client_id", "is required")
+		}
+		if !isAbsoluteURL(provider.RedirectURL) {
+			problem(prefix+"REDIRECT_URL", "oidc."+name+".redirect_url", "must be an absolute URL")
+		}
+	}
+}
+
+func isAbsoluteURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isOriginPattern reports whether value is an origin, or one whose host starts with a
+// *. wildcard standing for any subdomain
+func isOriginPattern(value string) bool {
+	switch strings.Count(value, "*") {
+	case 0:
+		return isOrigin(value)
+	case 1:
+		scheme, host, ok := strings.Cut(value, "://*.")
+		return ok && isOrigin(scheme+"://wildcard."+host)
+	default:
+		return false
+	}
+}
+
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// isHeaderName reports whether value is a valid HTTP header field name
+func isHeaderName(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOrigin reports whether value is a scheme and host with nothing after them
+func isOrigin(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && isAbsoluteURL(value) && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == ""
+}
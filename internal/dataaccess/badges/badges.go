@@ -0,0 +1,72 @@
+package badges
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// Award gives a badge to a user. Awarding a badge the user already has does nothing,
+// and false is returned in that case.
+func Award(ctx context.Context, db *database.Database, userID int, code string) (bool, error) {
+	query := `
+		INSERT INTO user_badges (user_id, badge_code, awarded_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id, badge_code) DO NOTHING
+	`
+	result, err := db.Exec(ctx, query, userID, code)
+	if err != nil {
+		return false, err
+	}
+	awarded, err := result.RowsAffected()
+	return awarded > 0, err
+}
+
+// ListCodesByUserID retrieves the codes of the badges a user has been awarded, with when they were awarded
+func ListCodesByUserID(ctx context.Context, db *database.Database, userID int) (map[string]time.Time, error) {
+	rows, err := db.Query(ctx, `
+		SELECT badge_code, awarded_at
+		FROM user_badges
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awarded := make(map[string]time.Time)
+	for rows.Next() {
+		var code string
+		var awardedAt time.Time
+		if err := rows.Scan(&code, database.UTC(&awardedAt)); err != nil {
+			return nil, err
+		}
+		awarded[code] = awardedAt
+	}
+	return awarded, rows.Err()
+}
+
+// GetActivityStats counts the threads and comments a user has posted and how long they have been a member
+func GetActivityStats(ctx context.Context, db *database.Database, userID int) (*models.ActivityStats, error) {
+	query := `
+		SELECT u.id,
+			(SELECT COUNT(*) FROM threads t WHERE t.user_id = u.id),
+			(SELECT COUNT(*) FROM comments c WHERE c.user_id = u.id),
+			COALESCE(DATE_PART('day', NOW() - u.created_at)::INT, 0)
+		FROM users u
+		WHERE u.id = $1
+	`
+	var stats models.ActivityStats
+	err := db.QueryRow(ctx, query, userID).Scan(&stats.UserID, &stats.ThreadCount, &stats.CommentCount, &stats.MemberDays)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("user with ID %d not found", userID)
+		}
+		return nil, err
+	}
+	return &stats, nil
+}
@@ -1,12 +1,16 @@
 package categories
 
 import (
+	"context"
+	"database/sql"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
 	"github.com/blobfish465/common-circle-web-forum/internal/database"
 	"github.com/blobfish465/common-circle-web-forum/internal/models"
 )
 
-func List(db *database.Database) ([]models.Category, error) {
-    rows, err := db.DB.Query("SELECT id, name FROM categories")
+func List(ctx context.Context, db *database.Database) ([]models.Category, error) {
+    rows, err := db.Query(ctx, "SELECT id, name FROM categories")
     if err != nil {
         return nil, err
     }
@@ -24,14 +28,17 @@ func List(db *database.Database) ([]models.Category, error) {
     return categories, nil
 }
 
-func GetCategoryByID(db *database.Database, id int) (*models.Category, error) {
+func GetCategoryByID(ctx context.Context, db *database.Database, id int) (*models.Category, error) {
     query := `SELECT id, name FROM categories WHERE id = $1`
 
-    row := db.DB.QueryRow(query, id)
+    row := db.QueryRow(ctx, query, id)
 
     var category models.Category
     err := row.Scan(&category.ID, &category.Name)
     if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, apperrors.NotFound("category with ID %d not found", id)
+        }
         return nil, err
     }
 
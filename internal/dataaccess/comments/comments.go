@@ -10,15 +10,17 @@ package comments
 }*/
 
 import (
+	"context"
 	"fmt"
 	"database/sql"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
 	"github.com/blobfish465/common-circle-web-forum/internal/database"
 	"github.com/blobfish465/common-circle-web-forum/internal/models"
 )
 
 // List retrieves all comments from the database.
-func List(db *database.Database) ([]models.Comment, error) {
-	rows, err := db.DB.Query(`
+func List(ctx context.Context, db *database.Database) ([]models.Comment, error) {
+	rows, err := db.Query(ctx, `
 		SELECT id, content, created_at, updated_at, user_id, thread_id 
 		FROM comments
 	`)
@@ -31,7 +33,7 @@ func List(db *database.Database) ([]models.Comment, error) {
 	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.UserID, &comment.ThreadID)
+		err := rows.Scan(&comment.ID, &comment.Content, database.UTC(&comment.CreatedAt), database.NullUTC(&comment.UpdatedAt), &comment.UserID, &comment.ThreadID)
 		if err != nil {
 			return nil, err
 		}
@@ -41,7 +43,7 @@ func List(db *database.Database) ([]models.Comment, error) {
 }
 
 // Get a comment from the database by its ID
-func GetCommentByID(db *database.Database, id int) (*models.Comment, error) {
+func GetCommentByID(ctx context.Context, db *database.Database, id int) (*models.Comment, error) {
 	var comment models.Comment
 	query := `
 		SELECT id, content, created_at, updated_at, user_id, thread_id 
@@ -49,12 +51,12 @@ func GetCommentByID(db *database.Database, id int) (*models.Comment, error) {
 		WHERE id = $1
 	`
 
-	row := db.DB.QueryRow(query, id)
+	row := db.QueryRow(ctx, query, id)
 
-	err := row.Scan(&comment.ID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.UserID, &comment.ThreadID)
+	err := row.Scan(&comment.ID, &comment.Content, database.UTC(&comment.CreatedAt), database.NullUTC(&comment.UpdatedAt), &comment.UserID, &comment.ThreadID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("comment with ID %d not found", id)
+			return nil, apperrors.NotFound("comment with ID %d not found", id)
 		}
 		return nil, fmt.Errorf("error retrieving comment with ID %d: %w", id, err)
 	}
@@ -63,14 +65,14 @@ func GetCommentByID(db *database.Database, id int) (*models.Comment, error) {
 }
 
 // retrieves all comments for a specific thread from the database
-func ListCommentsByThread(db *database.Database, threadID int) ([]models.Comment, error) {
+func ListCommentsByThread(ctx context.Context, db *database.Database, threadID int) ([]models.Comment, error) {
 	query := `
 		SELECT id, content, created_at, updated_at, user_id, thread_id 
 		FROM comments 
 		WHERE thread_id = $1
 	`
 
-	rows, err := db.DB.Query(query, threadID)
+	rows, err := db.Query(ctx, query, threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query for thread ID %d: %w", threadID, err)
 	}
@@ -79,7 +81,7 @@ func ListCommentsByThread(db *database.Database, threadID int) ([]models.Comment
 	var commentsList []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.UserID, &comment.ThreadID)
+		err := rows.Scan(&comment.ID, &comment.Content, database.UTC(&comment.CreatedAt), database.NullUTC(&comment.UpdatedAt), &comment.UserID, &comment.ThreadID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan comment data: %w", err)
 		}
@@ -95,7 +97,7 @@ func ListCommentsByThread(db *database.Database, threadID int) ([]models.Comment
 }
 
 // retrieves all the comments made by a specific user
-func ListCommentsByUserID(db *database.Database, userID int) ([]models.Comment, error) {
+func ListCommentsByUserID(ctx context.Context, db *database.Database, userID int) ([]models.Comment, error) {
 	query := `
 		SELECT id, content, created_at, updated_at, user_id, thread_id
 		FROM comments
@@ -103,7 +105,7 @@ func ListCommentsByUserID(db *database.Database, userID int) ([]models.Comment,
 		ORDER BY created_at DESC
 	`
 
-	rows, err := db.DB.Query(query, userID)
+	rows, err := db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +114,7 @@ func ListCommentsByUserID(db *database.Database, userID int) ([]models.Comment,
 	var commentsList []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.UserID, &comment.ThreadID)
+		err := rows.Scan(&comment.ID, &comment.Content, database.UTC(&comment.CreatedAt), database.NullUTC(&comment.UpdatedAt), &comment.UserID, &comment.ThreadID)
 		if err != nil {
 			return nil, err
 		}
@@ -124,33 +126,36 @@ func ListCommentsByUserID(db *database.Database, userID int) ([]models.Comment,
 
 
 // Create Comment functionality, inserts new comment into database
-func Create(db *database.Database, comment *models.Comment) (int, error) {
+func Create(ctx context.Context, db *database.Database, comment *models.Comment) (int, error) {
 	query := `
-		INSERT INTO comments (content, created_at, updated_at, user_id, thread_id)
-		VALUES ($1, NOW(), NOW(), $2, $3) RETURNING id
+		INSERT INTO comments (content, created_at, user_id, thread_id)
+		VALUES ($1, NOW(), $2, $3) RETURNING id, created_at
 	`
 	var id int
-	err := db.DB.QueryRow(query, comment.Content, comment.UserID, comment.ThreadID).Scan(&id)
+	err := db.QueryRow(ctx, query, comment.Content, comment.UserID, comment.ThreadID).Scan(&id, database.UTC(&comment.CreatedAt))
+	if database.IsForeignKeyViolation(err) {
+		return 0, apperrors.Validation("thread %d or user %d does not exist", comment.ThreadID, comment.UserID)
+	}
 	return id, err
 }
 
 // Update Comment functionality, update existing comment in database
-func Update(db *database.Database, comment *models.Comment) error {
+func Update(ctx context.Context, db *database.Database, comment *models.Comment) error {
 	query := `
 		UPDATE comments
 		SET content = $1, updated_at = NOW()
 		WHERE id = $2
 	`
-	_, err := db.DB.Exec(query, comment.Content, comment.ID)
+	_, err := db.Exec(ctx, query, comment.Content, comment.ID)
 	return err
 }
 
 // Delete comment functionality, delete existing comment in database by ID
-func Delete(db *database.Database, commentID int) error {
+func Delete(ctx context.Context, db *database.Database, commentID int) error {
 	query := `
 		DELETE FROM comments
 		WHERE id = $1
 	`
-	_, err := db.DB.Exec(query, commentID)
+	_, err := db.Exec(ctx, query, commentID)
 	return err
 }
\ No newline at end of file
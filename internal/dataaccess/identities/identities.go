@@ -0,0 +1,46 @@
+package identities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// GetByProviderSubject retrieves the identity linked for a provider's subject identifier
+func GetByProviderSubject(ctx context.Context, db *database.Database, provider string, subject string) (*models.LinkedIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM linked_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	row := db.QueryRow(ctx, query, provider, subject)
+
+	var identity models.LinkedIdentity
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, database.UTC(&identity.CreatedAt))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("identity %s/%s not found", provider, subject)
+		}
+		return nil, fmt.Errorf("error retrieving identity %s/%s: %w", provider, subject, err)
+	}
+
+	return &identity, nil
+}
+
+// Create links an external identity to a user, inserting it into the database
+func Create(ctx context.Context, db *database.Database, identity *models.LinkedIdentity) (int, error) {
+	query := `
+		INSERT INTO linked_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW()) RETURNING id, created_at
+	`
+	var id int
+	err := db.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&id, database.UTC(&identity.CreatedAt))
+	if database.IsUniqueViolation(err) {
+		return 0, apperrors.Conflict("this %s account is already linked", identity.Provider)
+	}
+	return id, err
+}
@@ -0,0 +1,57 @@
+package ratelimits
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+)
+
+// Take refills the token bucket with the given key at perSecond tokens a second, up to
+// capacity, and removes a token if there is a whole one left. It returns the tokens left
+// and whether one was taken. A bucket that does not exist yet starts full.
+//
+// The refill and the take happen in one statement, so concurrent requests from several
+// servers cannot spend the same token.
+func Take(ctx context.Context, db *database.Database, key string, capacity float64, perSecond float64) (float64, bool, error) {
+	query := `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at)
+		VALUES ($1, $2::float8 - 1, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8) - 1,
+			updated_at = NOW()
+		WHERE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8) >= 1
+		RETURNING tokens
+	`
+	var tokens float64
+	err := db.QueryRow(ctx, query, key, capacity, perSecond).Scan(&tokens)
+	if err == nil {
+		return tokens, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("failed to take a token for %s: %w", key, err)
+	}
+
+	// The bucket is empty and was left as it is, so its refill carries on from the last
+	// token taken. Report how far it has refilled since.
+	query = `
+		SELECT LEAST($2::float8, tokens + EXTRACT(EPOCH FROM NOW() - updated_at)::float8 * $3::float8)
+		FROM rate_limit_buckets
+		WHERE key = $1
+	`
+	if err := db.QueryRow(ctx, query, key, capacity, perSecond).Scan(&tokens); err != nil {
+		return 0, false, fmt.Errorf("failed to read the bucket for %s: %w", key, err)
+	}
+	return tokens, false, nil
+}
+
+// DeleteIdle deletes the buckets no token has been taken from for longer than idle
+func DeleteIdle(ctx context.Context, db *database.Database, idle time.Duration) (int64, error) {
+	result, err := db.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - make_interval(secs => $1)`, idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle rate limit buckets: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,81 @@
+package reputation
+
+import (
+	"context"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+)
+
+// Adjust adds points (which may be negative) to a user's reputation
+func Adjust(ctx context.Context, db *database.Database, userID int, points int) error {
+	query := `
+		INSERT INTO user_reputation (user_id, points, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET points = user_reputation.points + EXCLUDED.points, updated_at = NOW()
+	`
+	_, err := db.Exec(ctx, query, userID, points)
+	return err
+}
+
+// Get returns a user's reputation, which is 0 for users who have not earned any yet
+func Get(ctx context.Context, db *database.Database, userID int) (int, error) {
+	query := `SELECT COALESCE((SELECT points FROM user_reputation WHERE user_id = $1), 0)`
+	var points int
+	err := db.QueryRow(ctx, query, userID).Scan(&points)
+	return points, err
+}
+
+// Recalculate recomputes every user's reputation from scratch: upvotes received from other
+// users, answers accepted on other users' threads and full months of membership, each
+// weighted by the given points. It returns the number of users updated.
+func Recalculate(ctx context.Context, db *database.Database, upvotePoints int, acceptedAnswerPoints int, pointsPerMonth int) (int64, error) {
+	query := `
+		INSERT INTO user_reputation (user_id, points, updated_at)
+		SELECT u.id,
+			$1 * (
+				(SELECT COUNT(*) FROM votes v JOIN threads t ON t.id = v.thread_id WHERE t.user_id = u.id AND v.user_id <> u.id) +
+				(SELECT COUNT(*) FROM votes v JOIN comments c ON c.id = v.comment_id WHERE c.user_id = u.id AND v.user_id <> u.id)
+			)
+			+ $2 * (SELECT COUNT(*) FROM threads t JOIN comments c ON c.id = t.accepted_comment_id WHERE c.user_id = u.id AND t.user_id <> u.id)
+			+ $3 * COALESCE((DATE_PART('year', AGE(NOW(), u.created_at)) * 12 + DATE_PART('month', AGE(NOW(), u.created_at)))::INT, 0),
+			NOW()
+		FROM users u
+		ON CONFLICT (user_id) DO UPDATE
+		SET points = EXCLUDED.points, updated_at = EXCLUDED.updated_at
+	`
+	result, err := db.Exec(ctx, query, upvotePoints, acceptedAnswerPoints, pointsPerMonth)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Revoke takes back the points a user has given others: their upvotes and the answers
+// accepted on their threads, each weighted by the given points. It is used before the
+// user is deleted, as deleting them removes the votes and threads the points came from.
+func Revoke(ctx context.Context, db *database.Database, userID int, upvotePoints int, acceptedAnswerPoints int) error {
+	query := `
+		UPDATE user_reputation r
+		SET points = r.points - given.points, updated_at = NOW()
+		FROM (
+			SELECT recipient_id, SUM(points) AS points
+			FROM (
+				SELECT t.user_id AS recipient_id, $2::INT AS points
+				FROM votes v JOIN threads t ON t.id = v.thread_id
+				WHERE v.user_id = $1 AND t.user_id <> $1
+				UNION ALL
+				SELECT c.user_id, $2::INT
+				FROM votes v JOIN comments c ON c.id = v.comment_id
+				WHERE v.user_id = $1 AND c.user_id <> $1
+				UNION ALL
+				SELECT c.user_id, $3::INT
+				FROM threads t JOIN comments c ON c.id = t.accepted_comment_id
+				WHERE t.user_id = $1 AND c.user_id <> $1
+			) awarded
+			GROUP BY recipient_id
+		) given
+		WHERE r.user_id = given.recipient_id
+	`
+	_, err := db.Exec(ctx, query, userID, upvotePoints, acceptedAnswerPoints)
+	return err
+}
@@ -11,22 +11,39 @@ package threads
 }*/
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"database/sql"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
 	"github.com/blobfish465/common-circle-web-forum/internal/database"
 	"github.com/blobfish465/common-circle-web-forum/internal/models"
 )
 
+// threadSelect selects the columns read by scanThread, joined with the author's
+// username and reputation for display next to the thread
+const threadSelect = `
+	SELECT t.id, t.user_id, t.title, t.content, t.created_at, t.updated_at, t.category_id, t.accepted_comment_id,
+		u.username, COALESCE(r.points, 0)
+	FROM threads t
+	JOIN users u ON u.id = t.user_id
+	LEFT JOIN user_reputation r ON r.user_id = t.user_id
+`
+
+// rowScanner is implemented by both *database.Row and *database.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanThread reads a row selected with threadSelect into a thread
+func scanThread(row rowScanner, thread *models.Thread) error {
+	return row.Scan(&thread.ID, &thread.UserID, &thread.Title, &thread.Content, database.UTC(&thread.CreatedAt), database.NullUTC(&thread.UpdatedAt), &thread.CategoryID,
+		&thread.AcceptedCommentID, &thread.AuthorUsername, &thread.AuthorReputation)
+}
+
 // List retrieves all threads from the database, for home page where all threads are listed
-func List(db *database.Database) ([]models.Thread, error) {
-	log.Println("Executing query to fetch threads...")
-	rows, err := db.DB.Query(`
-		SELECT id, user_id, title, content, created_at, updated_at, category_id
-		FROM threads
-	`)
+func List(ctx context.Context, db *database.Database) ([]models.Thread, error) {
+	rows, err := db.Query(ctx, threadSelect)
 	if err != nil {
-		log.Println("Error executing query:", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -34,64 +51,66 @@ func List(db *database.Database) ([]models.Thread, error) {
 	var threads []models.Thread
 	for rows.Next() {
 		var thread models.Thread
-		err := rows.Scan(&thread.ID, &thread.UserID, &thread.Title, &thread.Content, &thread.CreatedAt, &thread.UpdatedAt, &thread.CategoryID)
+		err := scanThread(rows, &thread)
 		if err != nil {
-			log.Println("Error scanning row:", err)
 			return nil, err
 		}
 		threads = append(threads, thread)
 	}
 	if rows.Err() != nil {
-        log.Println("Row iteration error:", rows.Err())
         return nil, rows.Err()
     }
-	log.Printf("Fetched threads: %+v\n", threads)
 	return threads, nil
 }
 
 // Create thread functionality, inserts new thread into database
-func Create(db *database.Database, thread *models.Thread) (int, error) {
+func Create(ctx context.Context, db *database.Database, thread *models.Thread) (int, error) {
 	query := `
-		INSERT INTO threads (user_id, title, content, created_at, updated_at, category_id)
-		VALUES ($1, $2, $3, NOW(), NOW(), $4) RETURNING id
+		INSERT INTO threads (user_id, title, content, created_at, category_id)
+		VALUES ($1, $2, $3, NOW(), $4) RETURNING id, created_at
 	`
 	var id int
-	err := db.DB.QueryRow(query, thread.UserID, thread.Title, thread.Content, thread.CategoryID).Scan(&id)
+	err := db.QueryRow(ctx, query, thread.UserID, thread.Title, thread.Content, thread.CategoryID).Scan(&id, database.UTC(&thread.CreatedAt))
+	if database.IsForeignKeyViolation(err) {
+		return 0, apperrors.Validation("category %d or user %d does not exist", thread.CategoryID, thread.UserID)
+	}
 	return id, err
 }
 
 // Update thread functionality, update existing thread in database
-func Update(db *database.Database, thread *models.Thread) error {
+func Update(ctx context.Context, db *database.Database, thread *models.Thread) error {
 	query := `
 		UPDATE threads
 		SET title = $1, content = $2, category_id = $3, updated_at = NOW()
 		WHERE id = $4
 	`
-	_, err := db.DB.Exec(query, thread.Title, thread.Content, thread.CategoryID, thread.ID)
+	_, err := db.Exec(ctx, query, thread.Title, thread.Content, thread.CategoryID, thread.ID)
+	if database.IsForeignKeyViolation(err) {
+		return apperrors.Validation("category %d does not exist", thread.CategoryID)
+	}
 	return err
 }
 
 // Delete thread functionality, delete existing thread in database by its ID
-func Delete(db *database.Database, threadID int) error {
+func Delete(ctx context.Context, db *database.Database, threadID int) error {
 	query := `
 		DELETE FROM threads
 		WHERE id = $1 
 	`
-	_, err := db.DB.Exec(query, threadID)
+	_, err := db.Exec(ctx, query, threadID)
 	return err
 }
 
 // Get thread from the database by its ID
-func GetThreadByID(db *database.Database, id int) (*models.Thread, error) {
+func GetThreadByID(ctx context.Context, db *database.Database, id int) (*models.Thread, error) {
 	var thread models.Thread
-	query := `SELECT id, user_id, title, content, created_at, updated_at, category_id 
-	FROM threads WHERE id = $1`
-	row := db.DB.QueryRow(query, id)
+	query := threadSelect + `WHERE t.id = $1`
+	row := db.QueryRow(ctx, query, id)
 
-	err := row.Scan(&thread.ID, &thread.UserID, &thread.Title, &thread.Content, &thread.CreatedAt, &thread.UpdatedAt, &thread.CategoryID)
+	err := scanThread(row, &thread)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("thread with ID %d not found", id)
+			return nil, apperrors.NotFound("thread with ID %d not found", id)
 		}
 		return nil, fmt.Errorf("error retrieving thread with ID %d: %w", id, err)
 	}
@@ -100,12 +119,8 @@ func GetThreadByID(db *database.Database, id int) (*models.Thread, error) {
 }
 
 // Get all the threads of a specific user
-func ListByUserID(db *database.Database, userID int) ([]models.Thread, error) {
-	rows, err := db.DB.Query(`
-		SELECT id, user_id, title, content, created_at, updated_at, category_id
-		FROM threads
-		WHERE user_id = $1
-	`, userID)
+func ListByUserID(ctx context.Context, db *database.Database, userID int) ([]models.Thread, error) {
+	rows, err := db.Query(ctx, threadSelect+`WHERE t.user_id = $1`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve threads for user %d: %w", userID, err)
 	}
@@ -114,7 +129,7 @@ func ListByUserID(db *database.Database, userID int) ([]models.Thread, error) {
 	var threads []models.Thread
 	for rows.Next() {
 		var thread models.Thread
-		err := rows.Scan(&thread.ID, &thread.UserID, &thread.Title, &thread.Content, &thread.CreatedAt, &thread.UpdatedAt, &thread.CategoryID)
+		err := scanThread(rows, &thread)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan thread data: %w", err)
 		}
@@ -129,12 +144,8 @@ func ListByUserID(db *database.Database, userID int) ([]models.Thread, error) {
 }
 
 // Get all the threads of a category based on category_id, for filtering by category
-func ListByCategoryID(db *database.Database, categoryID int) ([]models.Thread, error) {
-    rows, err := db.DB.Query(`
-        SELECT id, user_id, title, content, created_at, updated_at, category_id
-        FROM threads
-        WHERE category_id = $1
-    `, categoryID)
+func ListByCategoryID(ctx context.Context, db *database.Database, categoryID int) ([]models.Thread, error) {
+    rows, err := db.Query(ctx, threadSelect+`WHERE t.category_id = $1`, categoryID)
     if err != nil {
         return nil, err
     }
@@ -143,7 +154,7 @@ func ListByCategoryID(db *database.Database, categoryID int) ([]models.Thread, e
     var threads []models.Thread
     for rows.Next() {
         var thread models.Thread
-        err := rows.Scan(&thread.ID, &thread.UserID, &thread.Title, &thread.Content, &thread.CreatedAt, &thread.UpdatedAt, &thread.CategoryID)
+        err := scanThread(rows, &thread)
         if err != nil {
             return nil, err
         }
@@ -152,4 +163,13 @@ func ListByCategoryID(db *database.Database, categoryID int) ([]models.Thread, e
     return threads, nil
 }
 
-
+// SetAcceptedComment marks a comment as the accepted answer of a thread, or clears it when commentID is nil
+func SetAcceptedComment(ctx context.Context, db *database.Database, threadID int, commentID *int) error {
+	query := `
+		UPDATE threads
+		SET accepted_comment_id = $1
+		WHERE id = $2
+	`
+	_, err := db.Exec(ctx, query, commentID, threadID)
+	return err
+}
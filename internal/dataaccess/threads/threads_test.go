@@ -0,0 +1,136 @@
+package threads_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/comments"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/threads"
+	"github.com/blobfish465/common-circle-web-forum/internal/database/dbtest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+func TestCreateAndGet(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	category := dbtest.Category(t, db)
+
+	thread := models.Thread{UserID: user.ID, CategoryID: category.ID, Title: "Question", Content: "Anyone?"}
+	id, err := threads.Create(ctx, db, &thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := threads.GetThreadByID(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Question" || stored.AuthorUsername != user.Username || stored.UpdatedAt != nil || stored.AcceptedCommentID != nil {
+		t.Errorf("thread = %+v, want the new thread by %s", stored, user.Username)
+	}
+
+	byUser, err := threads.ListByUserID(ctx, db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCategory, err := threads.ListByCategoryID(ctx, db, category.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byUser) != 1 || len(byCategory) != 1 || byUser[0].ID != id || byCategory[0].ID != id {
+		t.Errorf("threads by user = %+v and by category = %+v, want only thread %d", byUser, byCategory, id)
+	}
+
+	if _, err := threads.GetThreadByID(ctx, db, id+1000000); !apperrors.IsNotFound(err) {
+		t.Errorf("missing thread error = %v, want not found", err)
+	}
+}
+
+func TestCreateInMissingCategory(t *testing.T) {
+	db := dbtest.Open(t)
+	user := dbtest.User(t, db)
+
+	// The failed insert aborts the test transaction, so nothing is queried after it
+	thread := models.Thread{UserID: user.ID, CategoryID: 1000000, Title: "Question", Content: "Anyone?"}
+	_, err := threads.Create(context.Background(), db, &thread)
+	if apperrors.KindOf(err) != apperrors.KindValidation {
+		t.Errorf("error = %v, want a validation error", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	thread := dbtest.Thread(t, db, user.ID, dbtest.Category(t, db).ID)
+	moved := dbtest.Category(t, db)
+
+	thread.Title = "Edited"
+	thread.CategoryID = moved.ID
+	if err := threads.Update(ctx, db, &thread); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := threads.GetThreadByID(ctx, db, thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Edited" || stored.CategoryID != moved.ID || stored.UpdatedAt == nil {
+		t.Errorf("thread = %+v, want it edited and moved with an update time", stored)
+	}
+}
+
+func TestAcceptedCommentIsClearedWithTheComment(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	thread := dbtest.Thread(t, db, user.ID, dbtest.Category(t, db).ID)
+	comment := dbtest.Comment(t, db, thread.ID, user.ID)
+
+	if err := threads.SetAcceptedComment(ctx, db, thread.ID, &comment.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := threads.GetThreadByID(ctx, db, thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AcceptedCommentID == nil || *stored.AcceptedCommentID != comment.ID {
+		t.Fatalf("accepted comment = %v, want %d", stored.AcceptedCommentID, comment.ID)
+	}
+
+	if err := comments.Delete(ctx, db, comment.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = threads.GetThreadByID(ctx, db, thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AcceptedCommentID != nil {
+		t.Errorf("accepted comment = %d after deleting it, want none", *stored.AcceptedCommentID)
+	}
+}
+
+func TestDeleteRemovesComments(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	thread := dbtest.Thread(t, db, user.ID, dbtest.Category(t, db).ID)
+	dbtest.Comment(t, db, thread.ID, user.ID)
+
+	if err := threads.Delete(ctx, db, thread.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := threads.GetThreadByID(ctx, db, thread.ID); !apperrors.IsNotFound(err) {
+		t.Errorf("deleted thread error = %v, want not found", err)
+	}
+	remaining, err := comments.ListCommentsByThread(ctx, db, thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("comments = %+v, want none after deleting the thread", remaining)
+	}
+}
@@ -1,15 +1,18 @@
 package users
 
 import (
+	"context"
 	"fmt"
 	"database/sql"
-	"log"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
 	"github.com/blobfish465/common-circle-web-forum/internal/database"
 	"github.com/blobfish465/common-circle-web-forum/internal/models"
 )
 
-func List(db *database.Database) ([]models.User, error) {
-	rows, err := db.DB.Query("SELECT id, username, email FROM users")
+func List(ctx context.Context, db *database.Database) ([]models.User, error) {
+	rows, err := db.Query(ctx, "SELECT id, username, email FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -34,18 +37,26 @@ func List(db *database.Database) ([]models.User, error) {
 	return users, nil*/
 }
 
+// userColumns are the columns read by scanUser, in scan order
+const userColumns = `id, username, email, password_hash, COALESCE(display_name, ''), COALESCE(bio, ''), COALESCE(avatar_url, ''), email_verified, is_admin, created_at`
+
+// scanUser reads a row selected with userColumns into a user
+func scanUser(row *database.Row, user *models.User) error {
+	return row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.DisplayName, &user.Bio, &user.AvatarURL, &user.EmailVerified, &user.IsAdmin, database.UTC(&user.CreatedAt))
+}
+
 // to retrieve a user from the database by their ID. 
-func GetUserByID(db *database.Database, id int) (*models.User, error) {
-	query := `SELECT id, username, email, password_hash FROM users WHERE id = $1`
+func GetUserByID(ctx context.Context, db *database.Database, id int) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
-	row := db.DB.QueryRow(query, id)
+	row := db.QueryRow(ctx, query, id)
 
 	var user models.User
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash)
+	err := scanUser(row, &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with ID %d not found", id)
+			return nil, apperrors.NotFound("user with ID %d not found", id)
 		}
 		return nil, fmt.Errorf("error retrieving user: %w", err)
 	}
@@ -53,11 +64,14 @@ func GetUserByID(db *database.Database, id int) (*models.User, error) {
 	return &user, nil
 }
 
-// Create and add new user into the database
-func Create(db *database.Database, user *models.User) error {
-	// Use db.DB to access the actual *sql.DB instance
-	query := `INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3)`
-	_, err := db.DB.Exec(query, user.Username, user.Email, user.PasswordHash)
+// Create and add new user into the database, setting user.ID to the new row's ID
+func Create(ctx context.Context, db *database.Database, user *models.User) error {
+	// The query runs through db so it gets the query timeout
+	query := `INSERT INTO users (username, email, password_hash, email_verified) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := db.QueryRow(ctx, query, user.Username, user.Email, user.PasswordHash, user.EmailVerified).Scan(&user.ID, database.UTC(&user.CreatedAt))
+	if database.IsUniqueViolation(err) {
+		return apperrors.Conflict("username or email is already taken")
+	}
 	return err
 }
 
@@ -73,25 +87,175 @@ func CreateAndReturnID(db *sql.DB, user *models.User) (int, error) {
 }*/
 
 // Delete user from database
-func Delete(db *database.Database, userID int) error {
+func Delete(ctx context.Context, db *database.Database, userID int) error {
 	query := `DELETE FROM users WHERE id = $1`
-	_, err := db.DB.Exec(query, userID)
-	return err
+	result, err := db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return apperrors.NotFound("user with ID %d not found", userID)
+	}
+	return nil
 }
 
 // GetUserByUsername retrieves a user from the database by their username
-func GetUserByUsername(db *database.Database, username string) (*models.User, error) {
-	query := `SELECT id, username, email, password_hash FROM users WHERE username = $1`
-	row := db.DB.QueryRow(query, username)
+func GetUserByUsername(ctx context.Context, db *database.Database, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	row := db.QueryRow(ctx, query, username)
+
+	var user models.User
+	err := scanUser(row, &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("user with username %s not found", username)
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user from the database by their email address
+func GetUserByEmail(ctx context.Context, db *database.Database, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+	row := db.QueryRow(ctx, query, email)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash)
+	err := scanUser(row, &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with username %s not found", username)
+			return nil, apperrors.NotFound("user with email %s not found", email)
 		}
 		return nil, fmt.Errorf("error retrieving user: %w", err)
 	}
-	log.Printf("Fetched user: %+v\n", user) // Log the fetched user
 	return &user, nil
 }
+
+// UpdateProfile saves the editable profile fields of an existing user
+func UpdateProfile(ctx context.Context, db *database.Database, user *models.User) error {
+	query := `
+		UPDATE users
+		SET username = $1, display_name = NULLIF($2, ''), bio = NULLIF($3, ''), avatar_url = NULLIF($4, '')
+		WHERE id = $5
+	`
+	_, err := db.Exec(ctx, query, user.Username, user.DisplayName, user.Bio, user.AvatarURL, user.ID)
+	if database.IsUniqueViolation(err) {
+		return apperrors.Conflict("username %s is already taken", user.Username)
+	}
+	return err
+}
+
+// UpdatePasswordHash replaces the stored password hash of a user
+func UpdatePasswordHash(ctx context.Context, db *database.Database, userID int, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2`
+	_, err := db.Exec(ctx, query, passwordHash, userID)
+	return err
+}
+
+// UpdateEmail sets a user's email to an address they have just verified
+func UpdateEmail(ctx context.Context, db *database.Database, userID int, email string) error {
+	query := `UPDATE users SET email = $1, email_verified = TRUE WHERE id = $2`
+	_, err := db.Exec(ctx, query, email, userID)
+	if database.IsUniqueViolation(err) {
+		return apperrors.Conflict("email %s is already in use", email)
+	}
+	return err
+}
+
+// GetProfile retrieves the public profile of a user along with their thread and comment counts and reputation
+func GetProfile(ctx context.Context, db *database.Database, id int) (*models.UserProfile, error) {
+	query := `
+		SELECT u.id, u.username, u.email, COALESCE(u.display_name, ''), COALESCE(u.bio, ''), COALESCE(u.avatar_url, ''), u.created_at,
+			(SELECT COUNT(*) FROM threads t WHERE t.user_id = u.id),
+			(SELECT COUNT(*) FROM comments c WHERE c.user_id = u.id),
+			COALESCE((SELECT r.points FROM user_reputation r WHERE r.user_id = u.id), 0)
+		FROM users u
+		WHERE u.id = $1
+	`
+	row := db.QueryRow(ctx, query, id)
+
+	var profile models.UserProfile
+	err := row.Scan(&profile.ID, &profile.Username, &profile.Email, &profile.DisplayName, &profile.Bio, &profile.AvatarURL, database.UTC(&profile.JoinedAt),
+		&profile.ThreadCount, &profile.CommentCount, &profile.Reputation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("user with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("error retrieving profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// ListRecentActivity retrieves the latest threads and comments posted by a user, newest first
+func ListRecentActivity(ctx context.Context, db *database.Database, userID int, limit int) ([]models.Activity, error) {
+	rows, err := db.Query(ctx, `
+		SELECT 'thread', t.id, t.id, t.title, LEFT(t.content, 200), t.created_at
+		FROM threads t
+		WHERE t.user_id = $1
+		UNION ALL
+		SELECT 'comment', c.id, c.thread_id, t.title, LEFT(c.content, 200), c.created_at
+		FROM comments c
+		JOIN threads t ON t.id = c.thread_id
+		WHERE c.user_id = $1
+		ORDER BY 6 DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve activity for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	activity := []models.Activity{}
+	for rows.Next() {
+		var item models.Activity
+		err := rows.Scan(&item.Type, &item.ID, &item.ThreadID, &item.ThreadTitle, &item.Excerpt, database.UTC(&item.CreatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan activity data: %w", err)
+		}
+		activity = append(activity, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating over activity: %w", err)
+	}
+
+	return activity, nil
+}
+
+// ListPostsSince lists up to limit threads and comments posted by a user after since, newest first
+func ListPostsSince(ctx context.Context, db *database.Database, userID int, since time.Time, limit int) ([]models.Post, error) {
+	rows, err := db.Query(ctx, `
+		SELECT 'thread', id, content, created_at
+		FROM threads
+		WHERE user_id = $1 AND created_at > $2
+		UNION ALL
+		SELECT 'comment', id, content, created_at
+		FROM comments
+		WHERE user_id = $1 AND created_at > $2
+		ORDER BY 4 DESC
+		LIMIT $3
+	`, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve posts for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.Type, &post.ID, &post.Content, database.UTC(&post.CreatedAt)); err != nil {
+			return nil, fmt.Errorf("failed to scan post data: %w", err)
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating over posts: %w", err)
+	}
+
+	return posts, nil
+}
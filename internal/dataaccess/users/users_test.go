@@ -0,0 +1,146 @@
+package users_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/users"
+	"github.com/blobfish465/common-circle-web-forum/internal/database/dbtest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+func TestCreateAndGet(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	// The process ID keeps the names apart from test binaries running at the same time
+	name := fmt.Sprintf("Alice_%d", os.Getpid())
+	user := models.User{Username: name, Email: name + "@Example.com", PasswordHash: "hash", EmailVerified: true}
+	if err := users.Create(ctx, db, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.CreatedAt.IsZero() {
+		t.Fatalf("created user = %+v, want its ID and creation time set", user)
+	}
+
+	byID, err := users.GetUserByID(ctx, db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.Username != user.Username || !byID.EmailVerified || byID.CreatedAt.Location() != time.UTC {
+		t.Errorf("user by ID = %+v, want %+v in UTC", byID, user)
+	}
+
+	byUsername, err := users.GetUserByUsername(ctx, db, user.Username)
+	if err != nil || byUsername.ID != user.ID {
+		t.Errorf("user by username = %+v, %v, want user %d", byUsername, err, user.ID)
+	}
+
+	// Emails are looked up ignoring case
+	byEmail, err := users.GetUserByEmail(ctx, db, strings.ToLower(user.Email))
+	if err != nil || byEmail.ID != user.ID {
+		t.Errorf("user by email = %+v, %v, want user %d", byEmail, err, user.ID)
+	}
+
+	if _, err := users.GetUserByID(ctx, db, user.ID+1000000); !apperrors.IsNotFound(err) {
+		t.Errorf("missing user error = %v, want not found", err)
+	}
+}
+
+func TestCreateDuplicate(t *testing.T) {
+	db := dbtest.Open(t)
+	existing := dbtest.User(t, db)
+
+	// The failed insert aborts the test transaction, so nothing is queried after it
+	user := models.User{Username: existing.Username, Email: "other@example.com", PasswordHash: "hash"}
+	err := users.Create(context.Background(), db, &user)
+	if apperrors.KindOf(err) != apperrors.KindConflict {
+		t.Errorf("error = %v, want a conflict", err)
+	}
+}
+
+func TestUpdateProfileAndEmail(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+
+	user.DisplayName = "Alice A."
+	user.Bio = "Reads a lot"
+	if err := users.UpdateProfile(ctx, db, &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.UpdateEmail(ctx, db, user.ID, "changed_"+user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := users.GetUserByID(ctx, db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.DisplayName != "Alice A." || updated.Bio != "Reads a lot" || updated.AvatarURL != "" {
+		t.Errorf("profile = %+v, want the new display name and bio and no avatar", updated)
+	}
+	if updated.Email != "changed_"+user.Email || !updated.EmailVerified {
+		t.Errorf("email = %q verified %t, want the new address, verified", updated.Email, updated.EmailVerified)
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	category := dbtest.Category(t, db)
+	thread := dbtest.Thread(t, db, user.ID, category.ID)
+	dbtest.Comment(t, db, thread.ID, user.ID)
+	dbtest.Comment(t, db, thread.ID, user.ID)
+
+	profile, err := users.GetProfile(ctx, db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ThreadCount != 1 || profile.CommentCount != 2 || profile.Reputation != 0 {
+		t.Errorf("profile = %+v, want 1 thread, 2 comments and no reputation", profile)
+	}
+
+	activity, err := users.ListRecentActivity(ctx, db, user.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity) != 2 {
+		t.Errorf("activity = %+v, want the 2 latest posts", activity)
+	}
+}
+
+func TestDeleteCascades(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	other := dbtest.User(t, db)
+	category := dbtest.Category(t, db)
+	thread := dbtest.Thread(t, db, user.ID, category.ID)
+	comment := dbtest.Comment(t, db, thread.ID, other.ID)
+
+	if err := users.Delete(ctx, db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.GetUserByID(ctx, db, user.ID); !apperrors.IsNotFound(err) {
+		t.Errorf("deleted user error = %v, want not found", err)
+	}
+	// Deleting the thread's author removes the thread along with the comments on it
+	var comments int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM comments WHERE id = $1`, comment.ID).Scan(&comments); err != nil {
+		t.Fatal(err)
+	}
+	if comments != 0 {
+		t.Error("comment on the deleted user's thread still exists")
+	}
+	if err := users.Delete(ctx, db, user.ID); !apperrors.IsNotFound(err) {
+		t.Errorf("deleting again error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,46 @@
+package verifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// Create stores a pending email change. Only the hash of the token is stored, and any
+// earlier pending change for the same user is replaced.
+func Create(ctx context.Context, db *database.Database, userID int, email string, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear pending verifications for user %d: %w", userID, err)
+	}
+
+	query := `
+		INSERT INTO email_verifications (token_hash, user_id, email, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`
+	_, err = db.Exec(ctx, query, tokenHash, userID, email, expiresAt)
+	return err
+}
+
+// Consume removes the pending change with the given token hash and returns it, so each token can be used once
+func Consume(ctx context.Context, db *database.Database, tokenHash string) (*models.EmailVerification, error) {
+	query := `
+		DELETE FROM email_verifications
+		WHERE token_hash = $1
+		RETURNING user_id, email, expires_at
+	`
+	var verification models.EmailVerification
+	err := db.QueryRow(ctx, query, tokenHash).Scan(&verification.UserID, &verification.Email, database.UTC(&verification.ExpiresAt))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("email verification not found")
+		}
+		return nil, fmt.Errorf("error retrieving email verification: %w", err)
+	}
+	return &verification, nil
+}
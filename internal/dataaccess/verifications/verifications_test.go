@@ -0,0 +1,70 @@
+package verifications_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/verifications"
+	"github.com/blobfish465/common-circle-web-forum/internal/database/dbtest"
+)
+
+// tokenHash returns a token hash that no other test uses
+func tokenHash(userID int, token string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s", userID, token)))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestConsumeOnce(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	hash := tokenHash(user.ID, "token")
+	if err := verifications.Create(ctx, db, user.ID, "new@example.com", hash, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := verifications.Consume(ctx, db, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.UserID != user.ID || verification.Email != "new@example.com" || !verification.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("verification = %+v, want the pending change of user %d", verification, user.ID)
+	}
+
+	if _, err := verifications.Consume(ctx, db, hash); !apperrors.IsNotFound(err) {
+		t.Errorf("consuming again error = %v, want not found", err)
+	}
+}
+
+func TestCreateReplacesPendingChange(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.User(t, db)
+	expiresAt := time.Now().Add(time.Hour)
+
+	first, second := tokenHash(user.ID, "first"), tokenHash(user.ID, "second")
+	if err := verifications.Create(ctx, db, user.ID, "first@example.com", first, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifications.Create(ctx, db, user.ID, "second@example.com", second, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifications.Consume(ctx, db, first); !apperrors.IsNotFound(err) {
+		t.Errorf("replaced token error = %v, want not found", err)
+	}
+	verification, err := verifications.Consume(ctx, db, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Email != "second@example.com" {
+		t.Errorf("email = %q, want the latest pending address", verification.Email)
+	}
+}
@@ -0,0 +1,66 @@
+package votes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// targetColumns maps a target to its column in the votes table
+var targetColumns = map[string]string{
+	models.VoteTargetThread:  "thread_id",
+	models.VoteTargetComment: "comment_id",
+}
+
+// Add records an upvote by a user on a thread or comment.
+// It returns false if the user had already upvoted it.
+func Add(ctx context.Context, db *database.Database, userID int, target string, targetID int) (bool, error) {
+	column, ok := targetColumns[target]
+	if !ok {
+		return false, fmt.Errorf("unknown vote target %q", target)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO votes (user_id, %[1]s, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id, %[1]s) WHERE %[1]s IS NOT NULL DO NOTHING
+	`, column)
+	result, err := db.Exec(ctx, query, userID, targetID)
+	if err != nil {
+		return false, err
+	}
+	added, err := result.RowsAffected()
+	return added > 0, err
+}
+
+// Remove deletes a user's upvote on a thread or comment.
+// It returns false if there was no upvote to remove.
+func Remove(ctx context.Context, db *database.Database, userID int, target string, targetID int) (bool, error) {
+	column, ok := targetColumns[target]
+	if !ok {
+		return false, fmt.Errorf("unknown vote target %q", target)
+	}
+
+	query := fmt.Sprintf(`DELETE FROM votes WHERE user_id = $1 AND %s = $2`, column)
+	result, err := db.Exec(ctx, query, userID, targetID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// Count returns the number of upvotes on a thread or comment
+func Count(ctx context.Context, db *database.Database, target string, targetID int) (int, error) {
+	column, ok := targetColumns[target]
+	if !ok {
+		return 0, fmt.Errorf("unknown vote target %q", target)
+	}
+
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM votes WHERE %s = $1`, column)
+	err := db.QueryRow(ctx, query, targetID).Scan(&count)
+	return count, err
+}
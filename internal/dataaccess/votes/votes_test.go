@@ -0,0 +1,82 @@
+package votes_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/votes"
+	"github.com/blobfish465/common-circle-web-forum/internal/database/dbtest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+func TestAddAndRemove(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	author := dbtest.User(t, db)
+	voter := dbtest.User(t, db)
+	thread := dbtest.Thread(t, db, author.ID, dbtest.Category(t, db).ID)
+	comment := dbtest.Comment(t, db, thread.ID, author.ID)
+
+	for _, target := range []struct {
+		name string
+		id   int
+	}{{models.VoteTargetThread, thread.ID}, {models.VoteTargetComment, comment.ID}} {
+		t.Run(target.name, func(t *testing.T) {
+			added, err := votes.Add(ctx, db, voter.ID, target.name, target.id)
+			if err != nil || !added {
+				t.Fatalf("Add = %t, %v, want true", added, err)
+			}
+			// A user can upvote each target once
+			added, err = votes.Add(ctx, db, voter.ID, target.name, target.id)
+			if err != nil || added {
+				t.Fatalf("second Add = %t, %v, want false", added, err)
+			}
+
+			count, err := votes.Count(ctx, db, target.name, target.id)
+			if err != nil || count != 1 {
+				t.Errorf("Count = %d, %v, want 1", count, err)
+			}
+
+			removed, err := votes.Remove(ctx, db, voter.ID, target.name, target.id)
+			if err != nil || !removed {
+				t.Fatalf("Remove = %t, %v, want true", removed, err)
+			}
+			removed, err = votes.Remove(ctx, db, voter.ID, target.name, target.id)
+			if err != nil || removed {
+				t.Errorf("second Remove = %t, %v, want false", removed, err)
+			}
+		})
+	}
+}
+
+func TestVotesAreDeletedWithTheirTarget(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	author := dbtest.User(t, db)
+	voter := dbtest.User(t, db)
+	thread := dbtest.Thread(t, db, author.ID, dbtest.Category(t, db).ID)
+	comment := dbtest.Comment(t, db, thread.ID, author.ID)
+
+	if _, err := votes.Add(ctx, db, voter.ID, models.VoteTargetComment, comment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `DELETE FROM threads WHERE id = $1`, thread.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := votes.Count(ctx, db, models.VoteTargetComment, comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("votes on the deleted comment = %d, want 0", count)
+	}
+}
+
+func TestUnknownTarget(t *testing.T) {
+	db := dbtest.Open(t)
+
+	if _, err := votes.Add(context.Background(), db, 1, "user", 1); err == nil {
+		t.Error("Add on an unknown target succeeded, want an error")
+	}
+}
@@ -1,32 +1,40 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"os"
+	"errors"
+	"log/slog"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/lib/pq"
 )
 
 // Database struct wraps a pointer to an sql.DB instance, which represents a pool of database connections.
-// to extend database functionality later, such as adding helper methods for transactions or other operations.
+// Queries run through its helper methods, which add a timeout and run in a transaction started by WithTx.
 type Database struct {
 	DB *sql.DB
+	// QueryTimeout bounds each query run through Query, QueryRow and Exec. Zero means no limit.
+	QueryTimeout time.Duration
+
+	// tx is set on the copies passed to WithTx callbacks
+	tx *sql.Tx
 }
 
-// Creates and returns a new database connection wrapped in a Database struct.
-func GetDB() (*Database, error) {
-	log.Println("Fetching DATABASE_URL from environment...")
-	connStr := os.Getenv("DATABASE_URL")  // Fetch the database URL from environment variables
-    if connStr == "" {
-        log.Fatal("DATABASE_URL is not set in the environment variables")
-    }
+// DefaultQueryTimeout bounds the queries of databases opened without configuration, such as in tests
+const DefaultQueryTimeout = 5 * time.Second
+
+// defaultDB is the database shared by the whole server
+var defaultDB *Database
 
-	log.Println("Connecting to database with connection string:", connStr)
-    db, err := sql.Open("postgres", connStr)
+// Open connects to the database in cfg and brings its schema up to date
+func Open(cfg config.Database) (*Database, error) {
+	// The connection string holds the password, so only its redacted form is ever logged
+	slog.Info("connecting to database", "url", logging.Redact(cfg.URL))
+    db, err := sql.Open("postgres", cfg.URL)
     if err != nil {
-		log.Println("Error opening database connection:", err)
         return nil, err
     }
     db.SetMaxOpenConns(10)
@@ -35,31 +43,57 @@ func GetDB() (*Database, error) {
 
     err = setupTables(db)
     if err != nil {
+        db.Close()
         return nil, err
     }
 
-    return &Database{DB: db}, nil
+    return &Database{DB: db, QueryTimeout: cfg.QueryTimeout}, nil
+}
+
+// SetDefault makes db the database returned by GetDB. The server calls it once at startup.
+func SetDefault(db *Database) {
+	defaultDB = db
+}
+
+// GetDB returns the database shared by the whole server. Callers must not close it.
+func GetDB() (*Database, error) {
+	if defaultDB == nil {
+		return nil, errors.New("the database has not been opened")
+	}
+	return defaultDB, nil
+}
+
+// AppliedSchemaVersion returns the schema version recorded in the database, or 0 if the
+// schema has never been applied
+func (db *Database) AppliedSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := db.QueryRow(ctx, `SELECT version FROM schema_version`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) || isUndefinedTable(err) {
+		return 0, nil
+	}
+	return version, err
 }
 
 func (db *Database) Close() {
 	err := db.DB.Close()
 	if err != nil {
-		log.Println("Error closing database:", err)
+		slog.Error("failed to close database", "error", err)
 	}
 }
 
-func insertPredefinedCategories(db *sql.DB) error {
-	predefinedCategories := []string{
-		"Technology",
-		"Health",
-		"Education",
-		"Science",
-		"Sports",
-		"Travel",
-		"Entertainment",
-	}
+// PredefinedCategories are the categories every forum starts with
+var PredefinedCategories = []string{
+	"Technology",
+	"Health",
+	"Education",
+	"Science",
+	"Sports",
+	"Travel",
+	"Entertainment",
+}
 
-	for _, category := range predefinedCategories {
+func insertPredefinedCategories(db *sql.DB) error {
+	for _, category := range PredefinedCategories {
 		query := `
 		INSERT INTO categories (name)
 		VALUES ($1)
@@ -67,19 +101,26 @@ func insertPredefinedCategories(db *sql.DB) error {
 		`
 		_, err := db.Exec(query, category)
 		if err != nil {
-			log.Printf("Error inserting category %s: %v\n", category, err)
+			slog.Error("failed to insert category", "category", category, "error", err)
 			return err
 		}
 	}
 
-	log.Println("Predefined categories inserted successfully.")
+	slog.Debug("predefined categories inserted")
 	return nil
 }
 
 
-// setupTables creates tables if they do not exist
-func setupTables(db *sql.DB) error {
-	queries := []string{
+// ApplySchema creates any missing tables and columns and the predefined categories.
+// Open does this on every start; it is exported for databases opened elsewhere, such as in tests.
+func ApplySchema(db *sql.DB) error {
+	return setupTables(db)
+}
+
+// schema creates the tables and columns the server needs. Every statement can run again
+// on an up to date database, and changes are made by appending statements, never by
+// editing ones that have already been deployed.
+var schema = []string{
 		`
 		CREATE TABLE IF NOT EXISTS users (
 			id SERIAL PRIMARY KEY,
@@ -111,21 +152,139 @@ func setupTables(db *sql.DB) error {
 			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 			thread_id INT NOT NULL REFERENCES threads(id) ON DELETE CASCADE
 		);`,
-	}
+		`
+		CREATE TABLE IF NOT EXISTS linked_identities (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(64) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (provider, subject)
+		);`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100);`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;`,
+		`
+		CREATE TABLE IF NOT EXISTS email_verifications (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			email VARCHAR(255) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`ALTER TABLE threads ADD COLUMN IF NOT EXISTS accepted_comment_id INT REFERENCES comments(id) ON DELETE SET NULL;`,
+		`
+		CREATE TABLE IF NOT EXISTS votes (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			thread_id INT REFERENCES threads(id) ON DELETE CASCADE,
+			comment_id INT REFERENCES comments(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CHECK ((thread_id IS NULL) <> (comment_id IS NULL))
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS votes_user_thread_idx ON votes (user_id, thread_id) WHERE thread_id IS NOT NULL;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS votes_user_comment_idx ON votes (user_id, comment_id) WHERE comment_id IS NOT NULL;`,
+		`
+		CREATE TABLE IF NOT EXISTS user_reputation (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			points INT NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`
+		CREATE TABLE IF NOT EXISTS user_badges (
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			badge_code VARCHAR(64) NOT NULL,
+			awarded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, badge_code)
+		);`,
+		// Make the timestamp columns above time zone aware, on new databases as on existing
+		// ones. The stored values were written with NOW() on a UTC server, so they are read as UTC.
+		`
+		DO $$
+		DECLARE col RECORD;
+		BEGIN
+			FOR col IN
+				SELECT table_name, column_name FROM information_schema.columns
+				WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+			LOOP
+				EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+					col.table_name, col.column_name, col.column_name);
+			END LOOP;
+		END $$;`,
+		// Token buckets of the Postgres rate limit store, shared by every instance of the server
+		`
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key TEXT PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		);`,
+}
 
-	for _, query := range queries {
+// SchemaVersion is the version of the schema this build applies: the number of statements
+// in schema. Readiness checks compare it with the version recorded in the database.
+var SchemaVersion = len(schema)
+
+// setupTables creates tables if they do not exist and records the schema version
+func setupTables(db *sql.DB) error {
+	for _, query := range schema {
 		_, err := db.Exec(query)
 		if err != nil {
 			return err
 		}
 	}
 
+	// A single row holds the highest version applied, so an older build starting during
+	// a rolling deploy does not lower it
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			version INT NOT NULL
+		);`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO schema_version (version) VALUES ($1)
+		ON CONFLICT (id) DO UPDATE SET version = GREATEST(schema_version.version, EXCLUDED.version);`,
+		SchemaVersion)
+	if err != nil {
+		return err
+	}
+
 	// Insert predefined categories
-	err := insertPredefinedCategories(db)
+	err = insertPredefinedCategories(db)
 	if err != nil {
 		return err
 	}
 
-	log.Println("All tables are set up successfully.")
+	slog.Debug("database schema is up to date")
 	return nil
-}
\ No newline at end of file
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+	pqUndefinedTable      = "42P01"
+)
+
+// IsUniqueViolation reports whether err was caused by a unique constraint, e.g. a duplicate username
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
+
+// IsForeignKeyViolation reports whether err was caused by a reference to a row that does not exist
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqForeignKeyViolation
+}
+
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUndefinedTable
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time taken to run database queries, by the function that ran them, e.g. threads.List.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Database queries that failed, by the function that ran them. Finding no rows is not a failure.",
+	}, []string{"query"})
+)
+
+// queryNames caches the name of each function that runs queries, by program counter
+var queryNames sync.Map
+
+// queryName names the function skip frames above its caller, e.g. threads.List for a
+// query run by the dataaccess/threads package
+func queryName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	if name, ok := queryNames.Load(pc); ok {
+		return name.(string)
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+	queryNames.Store(pc, name)
+	return name
+}
+
+// observeQuery records how long a query took and whether it failed
+func observeQuery(name string, start time.Time, err error) {
+	queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		queryErrors.WithLabelValues(name).Inc()
+	}
+}
+
+// RegisterPoolMetrics exports the statistics of db's connection pool as the go_sql_*
+// metrics. It must be called at most once, for the pool the server shares.
+func RegisterPoolMetrics(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "forum"))
+}
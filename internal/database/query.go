@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/tracing"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Query runs a query that returns rows, bounded by the query timeout. The timeout is
+// released when the rows are closed, so callers must always close them.
+func (db *Database) Query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	ctx, done := startQuery(ctx, query)
+	rows, err := db.querier().QueryContext(ctx, query, args...)
+	done(err)
+	if err != nil {
+		cancel()
+		return nil, classify(ctx, err)
+	}
+	return &Rows{Rows: rows, ctx: ctx, cancel: cancel}, nil
+}
+
+// QueryRow runs a query that returns at most one row, bounded by the query timeout.
+// As with sql.Row, any error is deferred until Scan.
+func (db *Database) QueryRow(ctx context.Context, query string, args ...interface{}) *Row {
+	ctx, cancel := db.withTimeout(ctx)
+	// The query runs here; only its error waits for Scan
+	ctx, done := startQuery(ctx, query)
+	row := db.querier().QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return &Row{row: row, ctx: ctx, cancel: cancel}
+}
+
+// Exec runs a statement that returns no rows, bounded by the query timeout
+func (db *Database) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	ctx, done := startQuery(ctx, query)
+	result, err := db.querier().ExecContext(ctx, query, args...)
+	done(err)
+	return result, classify(ctx, err)
+}
+
+// startQuery starts a span for a query, named after the function that called Query,
+// QueryRow or Exec, e.g. threads.List. The returned function ends the span and records
+// the query's metrics.
+func startQuery(ctx context.Context, query string) (context.Context, func(err error)) {
+	name := queryName(2)
+	start := time.Now()
+	ctx, span := tracing.Tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(query)),
+	)
+	return ctx, func(err error) {
+		observeQuery(name, start, err)
+		if !errors.Is(err, sql.ErrNoRows) {
+			tracing.RecordError(span, err)
+		}
+		span.End()
+	}
+}
+
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
+// Rows is a result set from Query. Errors from a cancelled or timed out query are
+// reported as domain errors.
+type Rows struct {
+	*sql.Rows
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *Rows) Scan(dest ...interface{}) error {
+	return classify(r.ctx, r.Rows.Scan(dest...))
+}
+
+func (r *Rows) Err() error {
+	return classify(r.ctx, r.Rows.Err())
+}
+
+// Close closes the rows and releases the query timeout
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// Row is the result of QueryRow
+type Row struct {
+	row    *sql.Row
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Scan copies the row into dest, returning sql.ErrNoRows if the query matched nothing
+func (r *Row) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return classify(r.ctx, r.row.Scan(dest...))
+}
+
+// Postgres error codes for a query that was cancelled and for a server that is going away
+// or has run out of connections. Class 08 covers every kind of connection failure.
+const (
+	pqQueryCanceled       = "57014"
+	pqAdminShutdown       = "57P01"
+	pqCrashShutdown       = "57P02"
+	pqCannotConnectNow    = "57P03"
+	pqTooManyConnections  = "53300"
+	pqConnectionException = "08"
+)
+
+// classify turns errors caused by the query's context or by losing the database into
+// timeout and unavailable domain errors. Anything else, including sql.ErrNoRows, is
+// returned unchanged.
+func classify(ctx context.Context, err error) error {
+	if err == nil || err == sql.ErrNoRows {
+		return err
+	}
+
+	var pqErr *pq.Error
+	isPQ := errors.As(err, &pqErr)
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return apperrors.Wrap(apperrors.KindTimeout, err, "the database took too long to respond")
+	case errors.Is(ctx.Err(), context.Canceled):
+		return apperrors.Wrap(apperrors.KindUnavailable, err, "the request was cancelled")
+	case isPQ && pqErr.Code == pqQueryCanceled:
+		// Cancelled by statement_timeout on the server
+		return apperrors.Wrap(apperrors.KindTimeout, err, "the database took too long to respond")
+	case isPQ && (pqErr.Code.Class() == pqConnectionException ||
+		pqErr.Code == pqAdminShutdown || pqErr.Code == pqCrashShutdown ||
+		pqErr.Code == pqCannotConnectNow || pqErr.Code == pqTooManyConnections):
+		return apperrors.Wrap(apperrors.KindUnavailable, err, "the database is unavailable")
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return apperrors.Wrap(apperrors.KindUnavailable, err, "the database is unavailable")
+	}
+	return err
+}
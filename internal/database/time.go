@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UTC returns a scan destination that reads a TIMESTAMPTZ column into t, in UTC
+func UTC(t *time.Time) sql.Scanner {
+	return utcScanner{dest: t}
+}
+
+// NullUTC returns a scan destination that reads a nullable TIMESTAMPTZ column into t,
+// setting it to nil for NULL and to the time in UTC otherwise
+func NullUTC(t **time.Time) sql.Scanner {
+	return nullUTCScanner{dest: t}
+}
+
+type utcScanner struct {
+	dest *time.Time
+}
+
+func (s utcScanner) Scan(src interface{}) error {
+	var value sql.NullTime
+	if err := value.Scan(src); err != nil {
+		return err
+	}
+	if !value.Valid {
+		return errors.New("cannot scan NULL into a non-nullable timestamp")
+	}
+	*s.dest = value.Time.UTC()
+	return nil
+}
+
+type nullUTCScanner struct {
+	dest **time.Time
+}
+
+func (s nullUTCScanner) Scan(src interface{}) error {
+	var value sql.NullTime
+	if err := value.Scan(src); err != nil {
+		return err
+	}
+	if !value.Valid {
+		*s.dest = nil
+		return nil
+	}
+	utc := value.Time.UTC()
+	*s.dest = &utc
+	return nil
+}
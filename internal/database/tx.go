@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Querier runs queries. It is implemented by both *sql.DB and *sql.Tx, so the same code
+// can run on its own or as part of a transaction.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+var (
+	_ Querier = (*sql.DB)(nil)
+	_ Querier = (*sql.Tx)(nil)
+)
+
+// MaxTxAttempts is how many times WithTx runs a transaction that keeps failing to serialize
+const MaxTxAttempts = 3
+
+// Postgres error codes for a transaction that was rolled back so that another could proceed
+const (
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// querier returns the transaction db is bound to, or the connection pool otherwise
+func (db *Database) querier() Querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.DB
+}
+
+// UseTx returns a copy of db that runs every query in tx. It is for callers that manage
+// a transaction themselves, such as test harnesses; everything else should use WithTx.
+func (db *Database) UseTx(tx *sql.Tx) *Database {
+	bound := *db
+	bound.tx = tx
+	return &bound
+}
+
+// WithTx runs fn in a serializable transaction, passing it a copy of db bound to the
+// transaction. The transaction is committed if fn returns nil and rolled back otherwise.
+// When Postgres aborts it to resolve a conflict with another transaction, fn is run
+// again, up to MaxTxAttempts times, so fn must not have side effects outside the database.
+//
+// If db is already bound to a transaction, fn joins it instead of starting a new one.
+func (db *Database) WithTx(ctx context.Context, fn func(tx *Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	var err error
+	for attempt := 1; attempt <= MaxTxAttempts; attempt++ {
+		err = db.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+
+		// Back off a little, with jitter, so the conflicting transactions do not collide again
+		backoff := time.Duration(attempt)*10*time.Millisecond + time.Duration(rand.Intn(10))*time.Millisecond
+		select {
+		case <-ctx.Done():
+			return classify(ctx, ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", MaxTxAttempts, err)
+}
+
+func (db *Database) runTx(ctx context.Context, fn func(tx *Database) error) error {
+	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return classify(ctx, err)
+	}
+
+	if err := fn(db.UseTx(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return classify(ctx, tx.Commit())
+}
+
+// isRetryable reports whether err means the transaction was aborted to let another one
+// finish, so running it again may succeed
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected)
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "github.com/blobfish465/common-circle-web-forum/internal/models"
+
+// Category is a category as returned by the API
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewCategory maps a category model to its response
+func NewCategory(category models.Category) Category {
+	return Category{ID: category.ID, Name: category.Name}
+}
+
+// NewCategories maps a list of category models, returning an empty list rather than null when there are none
+func NewCategories(categories []models.Category) []Category {
+	responses := make([]Category, 0, len(categories))
+	for _, category := range categories {
+		responses = append(responses, NewCategory(category))
+	}
+	return responses
+}
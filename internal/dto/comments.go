@@ -0,0 +1,63 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// CommentCreateRequest is the body of a create comment request. The author is the authenticated user.
+type CommentCreateRequest struct {
+	Content  string `json:"content" validate:"required,max=10000"`
+	ThreadID int    `json:"thread_id" validate:"required"`
+}
+
+// ToModel maps the request to a new comment written by userID
+func (req CommentCreateRequest) ToModel(userID int) models.Comment {
+	return models.Comment{
+		Content:  req.Content,
+		UserID:   userID,
+		ThreadID: req.ThreadID,
+	}
+}
+
+// CommentUpdateRequest is the body of an update comment request
+type CommentUpdateRequest struct {
+	Content string `json:"content" validate:"required,max=10000"`
+}
+
+// ToModel maps the request to the updated comment with the given ID
+func (req CommentUpdateRequest) ToModel(commentID int) models.Comment {
+	return models.Comment{ID: commentID, Content: req.Content}
+}
+
+// Comment is a comment as returned by the API
+type Comment struct {
+	ID        int        `json:"id"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	UserID    int        `json:"user_id"`
+	ThreadID  int        `json:"thread_id"`
+}
+
+// NewComment maps a comment model to its response
+func NewComment(comment models.Comment) Comment {
+	return Comment{
+		ID:        comment.ID,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+		UserID:    comment.UserID,
+		ThreadID:  comment.ThreadID,
+	}
+}
+
+// NewComments maps a list of comment models, returning an empty list rather than null when there are none
+func NewComments(comments []models.Comment) []Comment {
+	responses := make([]Comment, 0, len(comments))
+	for _, comment := range comments {
+		responses = append(responses, NewComment(comment))
+	}
+	return responses
+}
@@ -0,0 +1,8 @@
+// Package dto defines the request and response bodies of the API, kept separate from the
+// models so that the database layer can change without changing what clients see.
+//
+// Request types only contain the fields a client may set. Server controlled fields, such
+// as IDs, authors and timestamps, are filled in by the handlers when mapping a request to a
+// model. Response types are the stable shape of the API: fields may be added, but renaming
+// or removing one needs a new API version.
+package dto
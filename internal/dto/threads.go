@@ -0,0 +1,85 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// ThreadCreateRequest is the body of a create thread request. The author is the authenticated user.
+type ThreadCreateRequest struct {
+	Title      string `json:"title" validate:"required,max=255"`
+	Content    string `json:"content" validate:"required,max=20000"`
+	CategoryID int    `json:"category_id" validate:"required"`
+}
+
+// ToModel maps the request to a new thread written by userID
+func (req ThreadCreateRequest) ToModel(userID int) models.Thread {
+	return models.Thread{
+		UserID:     userID,
+		Title:      req.Title,
+		Content:    req.Content,
+		CategoryID: req.CategoryID,
+	}
+}
+
+// ThreadUpdateRequest is the body of an update thread request
+type ThreadUpdateRequest struct {
+	Title      string `json:"title" validate:"required,max=255"`
+	Content    string `json:"content" validate:"required,max=20000"`
+	CategoryID int    `json:"category_id" validate:"required"`
+}
+
+// ToModel maps the request to the updated thread with the given ID
+func (req ThreadUpdateRequest) ToModel(threadID int) models.Thread {
+	return models.Thread{
+		ID:         threadID,
+		Title:      req.Title,
+		Content:    req.Content,
+		CategoryID: req.CategoryID,
+	}
+}
+
+// AcceptAnswerRequest is the body of an accept answer request, a null comment_id clears the accepted answer
+type AcceptAnswerRequest struct {
+	CommentID *int `json:"comment_id"`
+}
+
+// Thread is a thread as returned by the API
+type Thread struct {
+	ID                int        `json:"id"`
+	UserID            int        `json:"user_id"`
+	Title             string     `json:"title"`
+	Content           string     `json:"content"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+	CategoryID        int        `json:"category_id"`
+	AcceptedCommentID *int       `json:"accepted_comment_id,omitempty"`
+	AuthorUsername    string     `json:"author_username,omitempty"`
+	AuthorReputation  int        `json:"author_reputation"`
+}
+
+// NewThread maps a thread model to its response
+func NewThread(thread models.Thread) Thread {
+	return Thread{
+		ID:                thread.ID,
+		UserID:            thread.UserID,
+		Title:             thread.Title,
+		Content:           thread.Content,
+		CreatedAt:         thread.CreatedAt,
+		UpdatedAt:         thread.UpdatedAt,
+		CategoryID:        thread.CategoryID,
+		AcceptedCommentID: thread.AcceptedCommentID,
+		AuthorUsername:    thread.AuthorUsername,
+		AuthorReputation:  thread.AuthorReputation,
+	}
+}
+
+// NewThreads maps a list of thread models, returning an empty list rather than null when there are none
+func NewThreads(threads []models.Thread) []Thread {
+	responses := make([]Thread, 0, len(threads))
+	for _, thread := range threads {
+		responses = append(responses, NewThread(thread))
+	}
+	return responses
+}
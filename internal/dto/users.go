@@ -0,0 +1,139 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// LoginRequest is the body of a password login request
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// UserCreateRequest is the body of a sign up request
+type UserCreateRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+// UserUpdateRequest is the body of a PATCH /me request, fields left out are not changed
+type UserUpdateRequest struct {
+	Username    *string `json:"username" validate:"min=3,max=50"`
+	Email       *string `json:"email" validate:"email"`
+	DisplayName *string `json:"display_name" validate:"max=100"`
+	Bio         *string `json:"bio" validate:"max=1000"`
+	AvatarURL   *string `json:"avatar_url" validate:"url"`
+}
+
+// PasswordChangeRequest is the body of a change password request
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+// EmailVerifyRequest is the body of an email verification request
+type EmailVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// User is the account of the authenticated user, as returned by /me. It is never shown to other users.
+type User struct {
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	Bio           string    `json:"bio,omitempty"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	IsAdmin       bool      `json:"is_admin,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewUser maps a user model to its response
+func NewUser(user models.User) User {
+	return User{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+		IsAdmin:       user.IsAdmin,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// UserSummary is the public part of a user, as listed alongside other users
+type UserSummary struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// NewUserSummaries maps a list of user models, returning an empty list rather than null when there are none
+func NewUserSummaries(users []models.User) []UserSummary {
+	responses := make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, UserSummary{
+			ID:          user.ID,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+			AvatarURL:   user.AvatarURL,
+		})
+	}
+	return responses
+}
+
+// UserProfile is the profile of a user shown to other members. Email is only filled in
+// when the profile is viewed by its owner or an admin.
+type UserProfile struct {
+	ID             int        `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email,omitempty"`
+	DisplayName    string     `json:"display_name,omitempty"`
+	Bio            string     `json:"bio,omitempty"`
+	AvatarURL      string     `json:"avatar_url,omitempty"`
+	JoinedAt       time.Time  `json:"joined_at"`
+	ThreadCount    int        `json:"thread_count"`
+	CommentCount   int        `json:"comment_count"`
+	Reputation     int        `json:"reputation"`
+	RecentActivity []Activity `json:"recent_activity"`
+}
+
+// Activity is a thread or comment posted by a user, as listed on their profile
+type Activity struct {
+	Type        string    `json:"type"` // "thread" or "comment"
+	ID          int       `json:"id"`
+	ThreadID    int       `json:"thread_id"`
+	ThreadTitle string    `json:"thread_title"`
+	Excerpt     string    `json:"excerpt"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewUserProfile maps a profile model to its response, leaving out the email unless showEmail is set
+func NewUserProfile(profile models.UserProfile, showEmail bool) UserProfile {
+	response := UserProfile{
+		ID:             profile.ID,
+		Username:       profile.Username,
+		DisplayName:    profile.DisplayName,
+		Bio:            profile.Bio,
+		AvatarURL:      profile.AvatarURL,
+		JoinedAt:       profile.JoinedAt,
+		ThreadCount:    profile.ThreadCount,
+		CommentCount:   profile.CommentCount,
+		Reputation:     profile.Reputation,
+		RecentActivity: make([]Activity, 0, len(profile.RecentActivity)),
+	}
+	if showEmail {
+		response.Email = profile.Email
+	}
+	for _, activity := range profile.RecentActivity {
+		response.RecentActivity = append(response.RecentActivity, Activity(activity))
+	}
+	return response
+}
@@ -0,0 +1,6 @@
+package dto
+
+// VoteSummary is returned after voting on a thread or comment
+type VoteSummary struct {
+	Upvotes int `json:"upvotes"`
+}
@@ -0,0 +1,41 @@
+package badges
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/badges"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Handles listing every badge that can be earned
+func HandleListBadges(r *http.Request) (*api.Response, error) {
+	return api.Data(badges.Catalog(), "Badges retrieved successfully")
+}
+
+// Handles listing the badges awarded to a user
+func HandleListUserBadges(r *http.Request) (*api.Response, error) {
+	userIDStr := chi.URLParam(r, "id")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid user ID")
+	}
+
+	stores := store.From(r.Context())
+
+	// An unknown user has no badges list at all, rather than an empty one
+	if _, err := stores.Users.GetByID(r.Context(), userID); err != nil {
+		return nil, fmt.Errorf("failed to retrieve user %d: %w", userID, err)
+	}
+
+	userBadges, err := badges.ListForUser(r.Context(), stores.Badges, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve badges for user %d: %w", userID, err)
+	}
+
+	return api.Data(userBadges, fmt.Sprintf("Badges retrieved successfully for user %d", userID))
+}
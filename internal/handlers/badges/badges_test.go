@@ -0,0 +1,48 @@
+package badges_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/badges"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+func TestListBadges(t *testing.T) {
+	server := handlertest.New(t)
+
+	var catalog []models.Badge
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/badges", "", nil), http.StatusOK, &catalog)
+	if len(catalog) != len(badges.Catalog()) {
+		t.Errorf("catalog has %d badges, want %d", len(catalog), len(badges.Catalog()))
+	}
+}
+
+func TestListUserBadges(t *testing.T) {
+	server := handlertest.New(t)
+	user, _ := server.User("alice")
+
+	var awarded []models.UserBadge
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/1/badges", "", nil), http.StatusOK, &awarded)
+	if len(awarded) != 0 {
+		t.Fatalf("badges = %+v, want none", awarded)
+	}
+
+	stores := server.DB.Stores()
+	thread := models.Thread{UserID: user.ID, CategoryID: 1, Title: "Hello", Content: "First post"}
+	if _, err := stores.Threads.Create(context.Background(), &thread); err != nil {
+		t.Fatal(err)
+	}
+	if err := badges.Emit(context.Background(), stores.Badges, badges.Event{Type: badges.ThreadCreated, UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/1/badges", "", nil), http.StatusOK, &awarded)
+	if len(awarded) != 1 || awarded[0].Code != "first_thread" {
+		t.Errorf("badges = %+v, want first_thread", awarded)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/42/badges", "", nil), http.StatusNotFound, nil)
+}
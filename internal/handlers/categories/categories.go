@@ -8,8 +8,9 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"github.com/blobfish465/common-circle-web-forum/internal/api"
-	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/categories"
-    "github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
 	"github.com/pkg/errors"
 )
 
@@ -20,18 +21,13 @@ const (
 )
 
 // Retrieves all categories from the database and returns them as a JSON response.
-func HandleListCategories(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveDatabase, "HandleListCategories"))
-	}
-
-	categoriesList, err := categories.List(db)
+func HandleListCategories(r *http.Request) (*api.Response, error) {
+	categoriesList, err := store.From(r.Context()).Categories.List(r.Context())
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveCategories, "HandleListCategories"))
 	}
 
-	data, err := json.Marshal(categoriesList)
+	data, err := json.Marshal(dto.NewCategories(categoriesList))
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrEncodeView, "HandleListCategories"))
 	}
@@ -46,28 +42,23 @@ func HandleListCategories(w http.ResponseWriter, r *http.Request) (*api.Response
 
 
 // Retrieves the category details of a category
-func HandleGetCategoryByID(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleGetCategoryByID(r *http.Request) (*api.Response, error) {
     categoryIDStr := chi.URLParam(r, "id")
     if categoryIDStr == "" {
-        return nil, fmt.Errorf("missing category ID")
+        return nil, apperrors.Validation("missing category ID")
     }
 
     categoryID, err := strconv.Atoi(categoryIDStr)
     if err != nil {
-        return nil, fmt.Errorf("invalid category ID: %w", err)
-    }
-
-    db, err := database.GetDB()
-    if err != nil {
-        return nil, errors.Wrap(err, "failed to retrieve database")
+        return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid category ID")
     }
 
-    category, err := categories.GetCategoryByID(db, categoryID)
+    category, err := store.From(r.Context()).Categories.GetByID(r.Context(), categoryID)
     if err != nil {
         return nil, fmt.Errorf("failed to retrieve category: %w", err)
     }
 
-    data, err := json.Marshal(category)
+    data, err := json.Marshal(dto.NewCategory(*category))
     if err != nil {
         return nil, fmt.Errorf("failed to marshal category data: %w", err)
     }
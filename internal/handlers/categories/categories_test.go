@@ -0,0 +1,38 @@
+package categories_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+func TestListCategories(t *testing.T) {
+	server := handlertest.New(t)
+
+	var categories []models.Category
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/categories", "", nil), http.StatusOK, &categories)
+	if len(categories) != len(database.PredefinedCategories) {
+		t.Fatalf("categories = %+v, want the %d predefined ones", categories, len(database.PredefinedCategories))
+	}
+	for i, category := range categories {
+		if category.Name != database.PredefinedCategories[i] {
+			t.Errorf("category %d = %q, want %q", i, category.Name, database.PredefinedCategories[i])
+		}
+	}
+}
+
+func TestGetCategoryByID(t *testing.T) {
+	server := handlertest.New(t)
+
+	var category models.Category
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/categories/1", "", nil), http.StatusOK, &category)
+	if category.ID != 1 || category.Name != database.PredefinedCategories[0] {
+		t.Errorf("category = %+v, want %q", category, database.PredefinedCategories[0])
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/categories/999", "", nil), http.StatusNotFound, nil)
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/categories/abc", "", nil), http.StatusBadRequest, nil)
+}
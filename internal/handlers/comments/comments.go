@@ -7,10 +7,15 @@ import (
 	"strconv"
 	"github.com/go-chi/chi/v5"
 
+	"github.com/blobfish465/common-circle-web-forum/internal/antispam"
 	"github.com/blobfish465/common-circle-web-forum/internal/api"
-	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/comments"
-	"github.com/blobfish465/common-circle-web-forum/internal/database"
-	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/badges"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/validation"
 	"github.com/pkg/errors"
 )
 
@@ -23,18 +28,13 @@ const (
 )
 
 // ListComments
-func HandleListComments(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveDatabase, ListComments))
-	}
-
-	commentsList, err := comments.List(db)
+func HandleListComments(r *http.Request) (*api.Response, error) {
+	commentsList, err := store.From(r.Context()).Comments.List(r.Context())
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveComments, ListComments))
 	}
 
-	data, err := json.Marshal(commentsList)
+	data, err := json.Marshal(dto.NewComments(commentsList))
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrEncodeView, ListComments))
 	}
@@ -48,25 +48,20 @@ func HandleListComments(w http.ResponseWriter, r *http.Request) (*api.Response,
 }
 
 // Handles getting of comment by comment ID
-func HandleGetCommentByID(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleGetCommentByID(r *http.Request) (*api.Response, error) {
 	commentIDStr := chi.URLParam(r, "id")
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid comment ID: %w", err)
-	}
-
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid comment ID")
 	}
 
-	// Get the comment from the database by ID
-	comment, err := comments.GetCommentByID(db, commentID)
+	// Get the comment from the store by ID
+	comment, err := store.From(r.Context()).Comments.GetByID(r.Context(), commentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve comment with ID %d: %w", commentID, err)
 	}
 
-	data, err := json.Marshal(comment)
+	data, err := json.Marshal(dto.NewComment(*comment))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode comment data: %w", err)
 	}
@@ -78,25 +73,57 @@ func HandleGetCommentByID(w http.ResponseWriter, r *http.Request) (*api.Response
 }
 
 
-// Handles creation of comments 
-func HandleCreateComments(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	var comment models.Comment
-	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
-		return nil, fmt.Errorf("failed to decode comment: %w", err)
+// Handles creation of comments, which are written by the authenticated user
+func HandleCreateComments(r *http.Request) (*api.Response, error) {
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := api.Decode[dto.CommentCreateRequest](r)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := database.GetDB()
+	stores := store.From(r.Context())
+
+	// Comments can only be posted to threads that exist
+	_, err = stores.Threads.GetByID(r.Context(), req.ThreadID)
+	if apperrors.IsNotFound(err) {
+		return nil, validation.Field("thread_id", "thread %d does not exist", req.ThreadID)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, fmt.Errorf("failed to fetch thread: %w", err)
+	}
+
+	// The spam rules are checked in the transaction that inserts the comment, so concurrent
+	// posts cannot all pass them
+	comment := req.ToModel(userID)
+	err = stores.WithTx(r.Context(), func(tx *store.Stores) error {
+		if err := antispam.CheckPost(r.Context(), tx, userID, "", req.Content); err != nil {
+			return err
+		}
+		id, err := tx.Comments.Create(r.Context(), &comment)
+		if err != nil {
+			return fmt.Errorf("failed to create comment: %w", err)
+		}
+		comment.ID = id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Badges are a side effect, so a failure here should not fail the request
+	if err := badges.Emit(r.Context(), stores.Badges, badges.Event{Type: badges.CommentCreated, UserID: comment.UserID}); err != nil {
+		logging.FromContext(r.Context()).Error("failed to evaluate badges", "error", err)
 	}
 
-	id, err := comments.Create(db, &comment)
+	data, err := json.Marshal(dto.NewComment(comment))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create comment: %w", err)
+		return nil, fmt.Errorf("failed to encode comment data: %w", err)
 	}
 
-	comment.ID = id
-	data, _ := json.Marshal(comment)
 	return &api.Response{
 		Payload: api.Payload{Data: data},
 		Messages: []string{"Comment created successfully"},
@@ -104,28 +131,22 @@ func HandleCreateComments(w http.ResponseWriter, r *http.Request) (*api.Response
 }
 
 // Handles listing of comments by thread ID
-func HandleListCommentsByThread(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleListCommentsByThread(r *http.Request) (*api.Response, error) {
 	// Extract the thread ID using path parameters
 	threadIDStr := chi.URLParam(r, "thread_id")
 	threadID, err := strconv.Atoi(threadIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid thread ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid thread ID")
 	}
 
-	// Establish a database connection
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
-	}
-
-	// Call the dataaccess function to get the comments related to the thread from the database
-	commentsList, err := comments.ListCommentsByThread(db, threadID)
+	// Get the comments related to the thread from the store
+	commentsList, err := store.From(r.Context()).Comments.ListByThreadID(r.Context(), threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve comments for thread ID %d: %w", threadID, err)
 	}
 
 	// Marshal the comments data into JSON
-	data, err := json.Marshal(commentsList)
+	data, err := json.Marshal(dto.NewComments(commentsList))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode comments data: %w", err)
 	}
@@ -138,30 +159,25 @@ func HandleListCommentsByThread(w http.ResponseWriter, r *http.Request) (*api.Re
 }
 
 // Handles listing all comments made by a specific user
-func HandleListCommentsByUser(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleListCommentsByUser(r *http.Request) (*api.Response, error) {
 	// Extract the user ID from the URL
 	userIDStr := chi.URLParam(r, "userId")
 	if userIDStr == "" {
-		return nil, fmt.Errorf("user ID is missing in the request")
+		return nil, apperrors.Validation("user ID is missing in the request")
 	}
 
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
-	}
-
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid user ID")
 	}
 
-	comments, err := comments.ListCommentsByUserID(db, userID)
+	comments, err := store.From(r.Context()).Comments.ListByUserID(r.Context(), userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve comments for user %d: %w", userID, err)
 	}
 
 	// Encode the comments into JSON format
-	data, err := json.Marshal(comments)
+	data, err := json.Marshal(dto.NewComments(comments))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode comments: %w", err)
 	}
@@ -175,48 +191,40 @@ func HandleListCommentsByUser(w http.ResponseWriter, r *http.Request) (*api.Resp
 }
 
 // Handles update of comments
-func HandleUpdateComments(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleUpdateComments(r *http.Request) (*api.Response, error) {
 	commentIDStr := chi.URLParam(r, "id")
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid comment ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid comment ID")
 	}
 
 	// Decode request body to get updated comment details
-	var comment models.Comment
-	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
-		return nil, fmt.Errorf("failed to decode comment: %w", err)
-	}
-
-	// Get user ID from request context (set by AuthMiddleware, user_id is a string)
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		http.Error(w, "User ID is invalid", http.StatusUnauthorized)
-		return nil, nil
+	req, err := api.Decode[dto.CommentUpdateRequest](r)
+	if err != nil {
+		return nil, err
 	}
-	userID, err := strconv.Atoi(userIDStr)
 
-
-	db, err := database.GetDB()
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, err
 	}
 
-	originalComment, err := comments.GetCommentByID(db, commentID)
+	commentStore := store.From(r.Context()).Comments
+
+	originalComment, err := commentStore.GetByID(r.Context(), commentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch comment: %w", err)
 	}
 
 	// Check if the user is the owner of the comment
 	if originalComment.UserID != userID {
-		http.Error(w, "You are not authorized to update this comment", http.StatusForbidden)
-		return nil, nil
+		return nil, apperrors.Forbidden("you are not authorized to update this comment")
 	}
 
-	// Set the comment ID for the updated comment
-	comment.ID = commentID
+	comment := req.ToModel(commentID)
 
-	err = comments.Update(db, &comment)
+	err = commentStore.Update(r.Context(), &comment)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update comment: %w", err)
 	}
@@ -225,40 +233,34 @@ func HandleUpdateComments(w http.ResponseWriter, r *http.Request) (*api.Response
 }
 
 // Handles deletion of comments
-func HandleDeleteComments(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleDeleteComments(r *http.Request) (*api.Response, error) {
 	// Extract comment ID from URL path
 	commentIDStr := chi.URLParam(r, "id")
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid comment ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid comment ID")
 	}
 
-	// Get user ID from request context (set by AuthMiddleware, user_id is a string)
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		http.Error(w, "User ID is invalid", http.StatusUnauthorized)
-		return nil, nil
-	}
-	userID, err := strconv.Atoi(userIDStr)
-
-	db, err := database.GetDB()
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, err
 	}
 
-	originalComment, err := comments.GetCommentByID(db, commentID)
+	commentStore := store.From(r.Context()).Comments
+
+	originalComment, err := commentStore.GetByID(r.Context(), commentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch comment: %w", err)
 	}
 
 	// Check if the user is the owner of the comment
 	if originalComment.UserID != userID {
-		http.Error(w, "You are not authorized to delete this comment", http.StatusForbidden)
-		return nil, nil
+		return nil, apperrors.Forbidden("you are not authorized to delete this comment")
 	}
 
-	// Delete comment from the database
-	err = comments.Delete(db, commentID)
+	// Delete comment from the store
+	err = commentStore.Delete(r.Context(), commentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete comment: %w", err)
 	}
@@ -0,0 +1,106 @@
+package comments_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// newThread stores a thread by userID directly, as these tests are about its comments
+func newThread(t *testing.T, server *handlertest.Server, userID int) models.Thread {
+	t.Helper()
+
+	thread := models.Thread{UserID: userID, CategoryID: 1, Title: "Question", Content: "Anyone?"}
+	if _, err := server.DB.Stores().Threads.Create(context.Background(), &thread); err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
+
+func TestCreateComment(t *testing.T) {
+	server := handlertest.New(t)
+	author, token := server.User("alice")
+	thread := newThread(t, server, author.ID)
+
+	var comment dto.Comment
+	rec := server.Do(http.MethodPost, "/api/v1/comments", token, dto.CommentCreateRequest{ThreadID: thread.ID, Content: "Me!"})
+	handlertest.Decode(t, rec, http.StatusCreated, &comment)
+	if comment.ID == 0 || comment.UserID != author.ID || comment.ThreadID != thread.ID {
+		t.Errorf("created comment = %+v, want a new comment by user %d on thread %d", comment, author.ID, thread.ID)
+	}
+
+	var comments []dto.Comment
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/1/comments", "", nil), http.StatusOK, &comments)
+	if len(comments) != 1 || comments[0].Content != "Me!" {
+		t.Errorf("comments = %+v, want the new comment", comments)
+	}
+
+	// Posting a first comment earns a badge
+	awarded, err := server.DB.Stores().Badges.ListAwarded(context.Background(), author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := awarded["first_comment"]; !ok {
+		t.Errorf("badges = %v, want first_comment", awarded)
+	}
+}
+
+func TestCreateCommentOnMissingThread(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	rec := server.Do(http.MethodPost, "/api/v1/comments", token, dto.CommentCreateRequest{ThreadID: 42, Content: "Hello?"})
+	response := handlertest.Decode(t, rec, http.StatusUnprocessableEntity, nil)
+	if !handlertest.HasFieldError(response, "thread_id") {
+		t.Errorf("errors = %+v, want one for thread_id", response.Errors)
+	}
+}
+
+func TestUpdateAndDeleteCommentOnlyByAuthor(t *testing.T) {
+	server := handlertest.New(t)
+	author, authorToken := server.User("alice")
+	_, otherToken := server.User("bob")
+	newThread(t, server, author.ID)
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/comments", authorToken,
+		dto.CommentCreateRequest{ThreadID: 1, Content: "First draft"}), http.StatusCreated, nil)
+
+	update := dto.CommentUpdateRequest{Content: "Edited"}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/comments/1", otherToken, update), http.StatusForbidden, nil)
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/comments/1", otherToken, nil), http.StatusForbidden, nil)
+
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/comments/1", authorToken, update), http.StatusOK, nil)
+	comment, err := server.DB.Stores().Comments.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.Content != "Edited" {
+		t.Errorf("content = %q, want Edited", comment.Content)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/comments/1", authorToken, nil), http.StatusOK, nil)
+	var comments []dto.Comment
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/1/comments", "", nil), http.StatusOK, &comments)
+	if len(comments) != 0 {
+		t.Errorf("comments = %+v, want none after deleting", comments)
+	}
+}
+
+func TestListCommentsByUser(t *testing.T) {
+	server := handlertest.New(t)
+	author, token := server.User("alice")
+	newThread(t, server, author.ID)
+	for _, content := range []string{"One", "Two"} {
+		handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/comments", token,
+			dto.CommentCreateRequest{ThreadID: 1, Content: content}), http.StatusCreated, nil)
+	}
+
+	var comments []dto.Comment
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/1/comments", token, nil), http.StatusOK, &comments)
+	if len(comments) != 2 {
+		t.Errorf("comments = %+v, want both of alice's", comments)
+	}
+}
@@ -0,0 +1,165 @@
+// Package handlertest serves the API from the memory stores for handler tests. Requests go
+// through the router used in production, so authentication, decoding, validation and the
+// error responses are exercised along with the handlers, without a database.
+package handlertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/router"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/store/memory"
+	"github.com/blobfish465/common-circle-web-forum/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password is the password of every user created by User
+const Password = "password123"
+
+var (
+	hashOnce     sync.Once
+	passwordHash string
+)
+
+// Server is the API backed by a fresh memory database
+type Server struct {
+	// DB is the data the API reads and writes, for setting up and checking tests
+	DB *memory.DB
+
+	t       testing.TB
+	handler http.Handler
+}
+
+// New returns a server with no users and the predefined categories. Rate limiting is off.
+func New(t testing.TB) *Server {
+	t.Helper()
+
+	return NewWithStores(t, func(stores *store.Stores) *store.Stores { return stores })
+}
+
+// NewWithStores is New with the API using wrap(stores) instead of the stores of DB, so a
+// test can change how they behave, such as slowing them down to provoke a race
+func NewWithStores(t testing.TB, wrap func(stores *store.Stores) *store.Stores) *Server {
+	t.Helper()
+
+	utils.SetJWTSecret("handlertest-secret")
+	db := memory.New()
+	limits := middleware.NewRateLimits(config.RateLimit{Store: "none"}, nil)
+	apiConfig := config.API{LegacySunset: time.Now().Add(365 * 24 * time.Hour)}
+
+	return &Server{
+		DB:      db,
+		t:       t,
+		handler: router.Setup(wrap(db.Stores()), config.CORS{}, apiConfig, config.Metrics{}, limits),
+	}
+}
+
+// User creates a user whose password is Password and returns it with a token that
+// authenticates as them
+func (s *Server) User(username string) (models.User, string) {
+	s.t.Helper()
+
+	hashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+		if err != nil {
+			panic(err)
+		}
+		passwordHash = string(hash)
+	})
+
+	user := models.User{
+		Username:      username,
+		Email:         username + "@example.com",
+		PasswordHash:  passwordHash,
+		EmailVerified: true,
+	}
+	if err := s.DB.Stores().Users.Create(context.Background(), &user); err != nil {
+		s.t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user, s.Token(user.ID)
+}
+
+// Token returns a token that authenticates as the user with the given ID
+func (s *Server) Token(userID int) string {
+	s.t.Helper()
+
+	token, err := utils.GenerateJWT(strconv.Itoa(userID))
+	if err != nil {
+		s.t.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
+
+// Do sends a request to the API. A non-nil body is sent as JSON and a non-empty token as
+// a bearer token.
+func (s *Server) Do(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			s.t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// ServeHTTP serves the API, so tests that need a real listener can run it with httptest.NewServer
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Decode decodes the API response recorded in rec, and its data into data unless data is nil.
+// It fails the test if the status is not the wanted one.
+func Decode(t testing.TB, rec *httptest.ResponseRecorder, wantStatus int, data interface{}) api.Response {
+	t.Helper()
+
+	if rec.Code != wantStatus {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, wantStatus, rec.Body.String())
+	}
+
+	var response api.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(response.Payload.Data, data); err != nil {
+			t.Fatalf("failed to decode response data %q: %v", response.Payload.Data, err)
+		}
+	}
+	return response
+}
+
+// HasFieldError reports whether the response rejected the given field
+func HasFieldError(response api.Response, field string) bool {
+	for _, fieldErr := range response.Errors {
+		if fieldErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+)
+
+// checkTimeout bounds each readiness check, so a stuck database fails the probe instead of hanging it
+const checkTimeout = 2 * time.Second
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Report is the body of a probe response
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// Check is the outcome of one readiness check
+type Check struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	// Version and Expected are the applied and required schema versions
+	Version  int `json:"version,omitempty"`
+	Expected int `json:"expected,omitempty"`
+}
+
+// Handles the liveness probe, which succeeds for as long as the process can serve requests
+func HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: statusOK})
+}
+
+// Handles the readiness probe, which succeeds once the database answers and its schema is
+// at least the version this build expects. It responds with 503 otherwise.
+func HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := Report{Status: statusOK, Checks: map[string]Check{}}
+
+	db, err := database.GetDB()
+	if err != nil {
+		report.Checks["database"] = Check{Status: statusUnavailable, Error: "the database has not been opened"}
+	} else {
+		report.Checks["database"] = checkDatabase(r.Context(), db)
+		report.Checks["schema"] = checkSchema(r.Context(), db)
+	}
+
+	status := http.StatusOK
+	for name, check := range report.Checks {
+		if check.Status != statusOK {
+			report.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+			logging.FromContext(r.Context()).Warn("readiness check failed", "check", name, "error", check.Error)
+		}
+	}
+	writeReport(w, status, report)
+}
+
+func checkDatabase(ctx context.Context, db *database.Database) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.DB.PingContext(ctx)
+	check := Check{Status: statusOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		// The driver's error can name hosts and users, so it is only logged
+		logging.FromContext(ctx).Error("database ping failed", "error", err)
+		check.Status = statusUnavailable
+		check.Error = "the database is unreachable"
+	}
+	return check
+}
+
+func checkSchema(ctx context.Context, db *database.Database) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	version, err := db.AppliedSchemaVersion(ctx)
+	check := Check{
+		Status:     statusOK,
+		DurationMS: time.Since(start).Milliseconds(),
+		Version:    version,
+		Expected:   database.SchemaVersion,
+	}
+	switch {
+	case err != nil:
+		logging.FromContext(ctx).Error("failed to read the schema version", "error", err)
+		check.Status = statusUnavailable
+		check.Error = "the schema version could not be read"
+	case version < database.SchemaVersion:
+		check.Status = statusUnavailable
+		check.Error = "the schema is older than this build expects"
+	}
+	return check
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	// Probe results must reflect the server's state now, not a cached response
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("failed to encode probe response", "error", err)
+	}
+}
@@ -1,17 +1,23 @@
 package threads
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"github.com/go-chi/chi/v5"
-	"log"
 
+	"github.com/blobfish465/common-circle-web-forum/internal/antispam"
 	"github.com/blobfish465/common-circle-web-forum/internal/api"
-	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/threads"
-	"github.com/blobfish465/common-circle-web-forum/internal/database"
-	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/badges"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/validation"
 	"github.com/pkg/errors"
 )
 
@@ -24,32 +30,20 @@ const (
 )
 
 // ListThreads
-func HandleListThreads(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	log.Println("Handling /threads request...")
-
-	// Step 1: Get database connection
-	db, err := database.GetDB()
+func HandleListThreads(r *http.Request) (*api.Response, error) {
+	// Step 1: Fetch threads
+	threadsList, err := store.From(r.Context()).Threads.List(r.Context())
 	if err != nil {
-		log.Println("Database connection error:", err)
-		return nil, errors.Wrap(err, "failed to connect to the database")
-	}
-	defer db.Close()
-
-	// Step 2: Fetch threads
-	threadsList, err := threads.List(db) 
-	if err != nil {
-		log.Println("Error fetching threads:", err)
 		return nil, errors.Wrap(err, "failed to retrieve threads")
 	}
 
-	// Step 3: Encode threads to JSON
-	data, err := json.Marshal(threadsList)
+	// Step 2: Encode threads to JSON
+	data, err := json.Marshal(dto.NewThreads(threadsList))
 	if err != nil {
-		log.Println("Error encoding threads to JSON:", err)
 		return nil, errors.Wrap(err, "failed to encode threads")
 	}
 
-	// Step 4: Return API response
+	// Step 3: Return API response
 	response := &api.Response{
 		Payload: api.Payload{
 			Data: data,
@@ -61,24 +55,20 @@ func HandleListThreads(w http.ResponseWriter, r *http.Request) (*api.Response, e
 }
 
 // Get a thread by ID
-func HandleGetThreadByID(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleGetThreadByID(r *http.Request) (*api.Response, error) {
 	threadIDStr := chi.URLParam(r, "id")
 	threadID, err := strconv.Atoi(threadIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid thread ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid thread ID")
 	}
 
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
-	}
-	// Get thread from database 
-	thread, err := threads.GetThreadByID(db, threadID)
+	// Get thread from the store
+	thread, err := store.From(r.Context()).Threads.GetByID(r.Context(), threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve thread with ID %d: %w", threadID, err)
 	}
 
-	data, err := json.Marshal(thread)
+	data, err := json.Marshal(dto.NewThread(*thread))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode thread data: %w", err)
 	}
@@ -90,27 +80,22 @@ func HandleGetThreadByID(w http.ResponseWriter, r *http.Request) (*api.Response,
 }
 
 // List all of the threads created by a user
-func HandleListThreadsByUser(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleListThreadsByUser(r *http.Request) (*api.Response, error) {
 	userIDStr := chi.URLParam(r, "userId")
 	if userIDStr == "" {
-        return nil, fmt.Errorf("user ID is invalid or missing")
+        return nil, apperrors.Validation("user ID is invalid or missing")
     }
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid user ID")
 	}
 
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
-	}
-
-	threads, err := threads.ListByUserID(db, userID)
+	threads, err := store.From(r.Context()).Threads.ListByUserID(r.Context(), userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve threads for user %d: %w", userID, err)
 	}
 
-	data, err := json.Marshal(threads)
+	data, err := json.Marshal(dto.NewThreads(threads))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode threads: %w", err)
 	}
@@ -122,28 +107,64 @@ func HandleListThreadsByUser(w http.ResponseWriter, r *http.Request) (*api.Respo
 }
 
 
-// Handles creation of threads
-func HandleCreateThreads(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	var thread models.Thread
-	if err := json.NewDecoder(r.Body).Decode(&thread); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode thread: %v", err), http.StatusBadRequest)
+// checkCategoryExists reports a field error when a thread is filed under a category that does not exist
+func checkCategoryExists(ctx context.Context, categoryID int) error {
+	_, err := store.From(ctx).Categories.GetByID(ctx, categoryID)
+	if apperrors.IsNotFound(err) {
+		return validation.Field("category_id", "category %d does not exist", categoryID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch category: %w", err)
+	}
+	return nil
+}
+
+// Handles creation of threads, which are written by the authenticated user
+func HandleCreateThreads(r *http.Request) (*api.Response, error) {
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
 		return nil, err
 	}
 
-	db, err := database.GetDB()
+	req, err := api.Decode[dto.ThreadCreateRequest](r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve database: %v", err), http.StatusInternalServerError)
 		return nil, err
 	}
 
-	id, err := threads.Create(db, &thread)
+	if err := checkCategoryExists(r.Context(), req.CategoryID); err != nil {
+		return nil, err
+	}
+
+	stores := store.From(r.Context())
+
+	// The spam rules are checked in the transaction that inserts the thread, so concurrent
+	// posts cannot all pass them
+	thread := req.ToModel(userID)
+	err = stores.WithTx(r.Context(), func(tx *store.Stores) error {
+		if err := antispam.CheckPost(r.Context(), tx, userID, req.Title, req.Content); err != nil {
+			return err
+		}
+		id, err := tx.Threads.Create(r.Context(), &thread)
+		if err != nil {
+			return fmt.Errorf("failed to create thread: %w", err)
+		}
+		thread.ID = id
+		return nil
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create thread: %v", err), http.StatusInternalServerError)
 		return nil, err
 	}
 
-	thread.ID = id
-	data, _ := json.Marshal(thread)
+	// Badges are a side effect, so a failure here should not fail the request
+	if err := badges.Emit(r.Context(), stores.Badges, badges.Event{Type: badges.ThreadCreated, UserID: thread.UserID}); err != nil {
+		logging.FromContext(r.Context()).Error("failed to evaluate badges", "error", err)
+	}
+
+	data, err := json.Marshal(dto.NewThread(thread))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thread data: %w", err)
+	}
+
 	return &api.Response{
 		Payload: api.Payload{Data: data},
 		Messages: []string{"Thread created successfully"},
@@ -151,50 +172,46 @@ func HandleCreateThreads(w http.ResponseWriter, r *http.Request) (*api.Response,
 }
 
 // Handles update of threads
-func HandleUpdateThreads(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleUpdateThreads(r *http.Request) (*api.Response, error) {
 	// Extract the thread ID using path parameters
 	threadIDStr := chi.URLParam(r, "id")
 	threadID, err := strconv.Atoi(threadIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid thread ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid thread ID")
 	}
 
 	// Decode request body to get updated thread details
-	var thread models.Thread
-	if err := json.NewDecoder(r.Body).Decode(&thread); err != nil {
-		return nil, fmt.Errorf("failed to decode thread: %w", err)
-	}
-
-	// Get user ID from request context (set by AuthMiddleware, user_id is a string)
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		http.Error(w, "User ID is invalid", http.StatusUnauthorized)
-		return nil, nil
+	req, err := api.Decode[dto.ThreadUpdateRequest](r)
+	if err != nil {
+		return nil, err
 	}
-	userID, err := strconv.Atoi(userIDStr)
 
-	db, err := database.GetDB()
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, err
 	}
 
-	originalThread, err := threads.GetThreadByID(db, threadID)
+	threadStore := store.From(r.Context()).Threads
+
+	originalThread, err := threadStore.GetByID(r.Context(), threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch thread: %w", err)
 	}
 
 	// Ensure the user owns the thread
 	if originalThread.UserID != userID {
-		http.Error(w, "You are not authorized to update this thread", http.StatusForbidden)
-		return nil, nil
+		return nil, apperrors.Forbidden("you are not authorized to update this thread")
 	}
 
-	// Set the thread ID for the updated thread
-	thread.ID = threadID
+	if err := checkCategoryExists(r.Context(), req.CategoryID); err != nil {
+		return nil, err
+	}
 
+	thread := req.ToModel(threadID)
 
-	// Call update function in dataaccess thread
-	err = threads.Update(db, &thread)
+
+	err = threadStore.Update(r.Context(), &thread)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update thread: %w", err)
 	}
@@ -203,39 +220,33 @@ func HandleUpdateThreads(w http.ResponseWriter, r *http.Request) (*api.Response,
 }
 
 // Handles deletion of threads
-func HandleDeleteThreads(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleDeleteThreads(r *http.Request) (*api.Response, error) {
 	threadIDStr := chi.URLParam(r, "id")
 	// Convert threadID to an integer
 	threadID, err := strconv.Atoi(threadIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid thread ID: %w", err)
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid thread ID")
 	}
 
-	// Get user ID from request context (set by AuthMiddleware, user_id is a string)
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		http.Error(w, "User ID is invalid", http.StatusUnauthorized)
-		return nil, nil
-	}
-	userID, err := strconv.Atoi(userIDStr)
-
-	db, err := database.GetDB()
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve database: %w", err)
+		return nil, err
 	}
-	
-	originalThread, err := threads.GetThreadByID(db, threadID)
+
+	threadStore := store.From(r.Context()).Threads
+
+	originalThread, err := threadStore.GetByID(r.Context(), threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch thread: %w", err)
 	}
 
 	// Ensure the user owns the thread
 	if originalThread.UserID != userID {
-		http.Error(w, "You are not authorized to update this thread", http.StatusForbidden)
-		return nil, nil
+		return nil, apperrors.Forbidden("you are not authorized to update this thread")
 	}
 
-	err = threads.Delete(db, threadID)
+	err = threadStore.Delete(r.Context(), threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete thread: %w", err)
 	}
@@ -244,32 +255,21 @@ func HandleDeleteThreads(w http.ResponseWriter, r *http.Request) (*api.Response,
 }
 
 // Handles listing of threads by category, for filtering threads by category
-func HandleListThreadsByCategory(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleListThreadsByCategory(r *http.Request) (*api.Response, error) {
     categoryIDStr := chi.URLParam(r, "id")
 	// chi.URLParam always extract parameters for URL as strings so need convert to int
 	categoryID, err := strconv.Atoi(categoryIDStr)
     if err != nil {
-        return nil, fmt.Errorf("invalid category ID: %w", err)
+        return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid category ID")
     }
 
-    db, err := database.GetDB()
-    if err != nil {
-        return nil, fmt.Errorf("failed to retrieve database: %w", err)
-    }
-
-    threads, err := threads.ListByCategoryID(db, categoryID)
+    threads, err := store.From(r.Context()).Threads.ListByCategoryID(r.Context(), categoryID)
     if err != nil {
         return nil, fmt.Errorf("failed to retrieve threads for category %d: %w", categoryID, err)
     }
 
-	// Return an empty array if there are no threads in the category
-    if len(threads) == 0 {
-        threads = []models.Thread{}
-    }
-
-
-	// Marshal threads(a slice of models.Thread) into JSON format
-	data, err := json.Marshal(threads)
+	// Marshal the threads into JSON format, NewThreads returns an empty array if there are none
+	data, err := json.Marshal(dto.NewThreads(threads))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode threads: %w", err)
 	}
@@ -281,3 +281,86 @@ func HandleListThreadsByCategory(w http.ResponseWriter, r *http.Request) (*api.R
         Messages: []string{"Threads retrieved successfully"},
     }, nil
 }
+
+// Handles marking a comment as the accepted answer of a thread, which only the thread's owner can do
+func HandleAcceptAnswer(r *http.Request) (*api.Response, error) {
+	threadID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid thread ID")
+	}
+
+	req, err := api.Decode[dto.AcceptAnswerRequest](r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The thread is read again inside the transaction, so the points follow the answer that
+	// was actually replaced even when two requests race, and the accepted answer and the
+	// reputation it is worth change together or not at all
+	err = store.From(r.Context()).WithTx(r.Context(), func(tx *store.Stores) error {
+		return acceptAnswer(r.Context(), tx, userID, threadID, req.CommentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.Response{Messages: []string{"Accepted answer updated successfully"}}, nil
+}
+
+// acceptAnswer marks commentID as the accepted answer of a thread owned by userID, or
+// clears it when commentID is nil, and moves the reputation the answer is worth
+func acceptAnswer(ctx context.Context, tx *store.Stores, userID int, threadID int, commentID *int) error {
+	thread, err := tx.Threads.GetByID(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch thread: %w", err)
+	}
+	if thread.UserID != userID {
+		return apperrors.Forbidden("you are not authorized to accept an answer for this thread")
+	}
+
+	// Work out whose reputation changes before updating the thread
+	var previousAuthorID, newAuthorID int
+	if thread.AcceptedCommentID != nil {
+		previous, err := tx.Comments.GetByID(ctx, *thread.AcceptedCommentID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch accepted comment: %w", err)
+		}
+		previousAuthorID = previous.UserID
+	}
+	if commentID != nil {
+		comment, err := tx.Comments.GetByID(ctx, *commentID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch comment: %w", err)
+		}
+		if comment.ThreadID != threadID {
+			return apperrors.Validation("comment %d does not belong to thread %d", comment.ID, threadID)
+		}
+		newAuthorID = comment.UserID
+	}
+
+	if err := tx.Threads.SetAcceptedComment(ctx, threadID, commentID); err != nil {
+		return fmt.Errorf("failed to update accepted answer: %w", err)
+	}
+
+	// Answering your own thread earns nothing, and re-accepting the same comment changes nothing
+	if thread.AcceptedCommentID != nil && commentID != nil && *thread.AcceptedCommentID == *commentID {
+		return nil
+	}
+	if previousAuthorID != 0 && previousAuthorID != thread.UserID {
+		if err := reputation.Award(ctx, tx.Reputation, previousAuthorID, -reputation.AcceptedAnswerPoints); err != nil {
+			return fmt.Errorf("failed to update reputation: %w", err)
+		}
+	}
+	if newAuthorID != 0 && newAuthorID != thread.UserID {
+		if err := reputation.Award(ctx, tx.Reputation, newAuthorID, reputation.AcceptedAnswerPoints); err != nil {
+			return fmt.Errorf("failed to update reputation: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package threads_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/antispam"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+func createThread(t *testing.T, server *handlertest.Server, token string, title string) dto.Thread {
+	t.Helper()
+
+	var thread dto.Thread
+	rec := server.Do(http.MethodPost, "/api/v1/threads", token, dto.ThreadCreateRequest{
+		Title:      title,
+		Content:    "What is everyone reading?",
+		CategoryID: 1,
+	})
+	handlertest.Decode(t, rec, http.StatusCreated, &thread)
+	return thread
+}
+
+func TestCreateThread(t *testing.T) {
+	server := handlertest.New(t)
+	author, token := server.User("alice")
+
+	thread := createThread(t, server, token, "Book club")
+	if thread.ID == 0 || thread.UserID != author.ID || thread.Title != "Book club" {
+		t.Errorf("created thread = %+v, want a new thread by user %d", thread, author.ID)
+	}
+
+	var fetched dto.Thread
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/1", "", nil), http.StatusOK, &fetched)
+	if fetched.AuthorUsername != "alice" {
+		t.Errorf("author_username = %q, want alice", fetched.AuthorUsername)
+	}
+
+	// Starting a first thread earns a badge
+	awarded, err := server.DB.Stores().Badges.ListAwarded(context.Background(), author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := awarded["first_thread"]; !ok {
+		t.Errorf("badges = %v, want first_thread", awarded)
+	}
+}
+
+func TestCreateThreadRequiresAuthentication(t *testing.T) {
+	server := handlertest.New(t)
+
+	rec := server.Do(http.MethodPost, "/api/v1/threads", "", dto.ThreadCreateRequest{Title: "Hi", Content: "Hello", CategoryID: 1})
+	handlertest.Decode(t, rec, http.StatusUnauthorized, nil)
+}
+
+func TestCreateThreadValidation(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	tests := []struct {
+		name  string
+		req   dto.ThreadCreateRequest
+		field string
+	}{
+		{"missing title", dto.ThreadCreateRequest{Content: "Hello", CategoryID: 1}, "title"},
+		{"missing content", dto.ThreadCreateRequest{Title: "Hi", CategoryID: 1}, "content"},
+		{"unknown category", dto.ThreadCreateRequest{Title: "Hi", Content: "Hello", CategoryID: 999}, "category_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads", token, tt.req), http.StatusUnprocessableEntity, nil)
+			if !handlertest.HasFieldError(response, tt.field) {
+				t.Errorf("errors = %+v, want one for %s", response.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestGetThreadNotFound(t *testing.T) {
+	server := handlertest.New(t)
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/42", "", nil), http.StatusNotFound, nil)
+}
+
+func TestListThreads(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	var threads []dto.Thread
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads", "", nil), http.StatusOK, &threads)
+	if len(threads) != 0 {
+		t.Fatalf("threads = %+v, want none", threads)
+	}
+
+	createThread(t, server, token, "First")
+	createThread(t, server, token, "Second")
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/categories/1/threads", "", nil), http.StatusOK, &threads)
+	if len(threads) != 2 || threads[0].Title != "First" || threads[1].Title != "Second" {
+		t.Errorf("threads = %+v, want First and Second", threads)
+	}
+}
+
+func TestUpdateAndDeleteThreadOnlyByAuthor(t *testing.T) {
+	server := handlertest.New(t)
+	_, authorToken := server.User("alice")
+	_, otherToken := server.User("bob")
+	thread := createThread(t, server, authorToken, "Original")
+
+	update := dto.ThreadUpdateRequest{Title: "Edited", Content: "New content", CategoryID: 2}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1", otherToken, update), http.StatusForbidden, nil)
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/threads/1", otherToken, nil), http.StatusForbidden, nil)
+
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1", authorToken, update), http.StatusOK, nil)
+	var updated dto.Thread
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/1", "", nil), http.StatusOK, &updated)
+	if updated.Title != "Edited" || updated.CategoryID != 2 || updated.UpdatedAt == nil {
+		t.Errorf("updated thread = %+v, want the edit applied", updated)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/threads/1", authorToken, nil), http.StatusOK, nil)
+	if _, err := server.DB.Stores().Threads.GetByID(context.Background(), thread.ID); err == nil {
+		t.Error("thread still exists after being deleted")
+	}
+}
+
+func TestAcceptAnswer(t *testing.T) {
+	server := handlertest.New(t)
+	ctx := context.Background()
+	stores := server.DB.Stores()
+	_, askerToken := server.User("alice")
+	first, _ := server.User("bob")
+	second, _ := server.User("carol")
+
+	createThread(t, server, askerToken, "Question")
+	answer := models.Comment{ThreadID: 1, UserID: first.ID, Content: "An answer"}
+	if _, err := stores.Comments.Create(ctx, &answer); err != nil {
+		t.Fatal(err)
+	}
+	better := models.Comment{ThreadID: 1, UserID: second.ID, Content: "A better answer"}
+	if _, err := stores.Comments.Create(ctx, &better); err != nil {
+		t.Fatal(err)
+	}
+
+	points := func(userID int) int {
+		t.Helper()
+		profile, err := stores.Users.GetProfile(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return profile.Reputation
+	}
+
+	// Only the thread's author can accept an answer
+	_, otherToken := server.User("dave")
+	accept := dto.AcceptAnswerRequest{CommentID: &answer.ID}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1/accepted-comment", otherToken, accept), http.StatusForbidden, nil)
+
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1/accepted-comment", askerToken, accept), http.StatusOK, nil)
+	if got := points(first.ID); got != reputation.AcceptedAnswerPoints {
+		t.Errorf("reputation of the accepted author = %d, want %d", got, reputation.AcceptedAnswerPoints)
+	}
+
+	// Accepting another answer moves the points
+	accept = dto.AcceptAnswerRequest{CommentID: &better.ID}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1/accepted-comment", askerToken, accept), http.StatusOK, nil)
+	if got := points(first.ID); got != 0 {
+		t.Errorf("reputation of the previously accepted author = %d, want 0", got)
+	}
+	if got := points(second.ID); got != reputation.AcceptedAnswerPoints {
+		t.Errorf("reputation of the newly accepted author = %d, want %d", got, reputation.AcceptedAnswerPoints)
+	}
+
+	var thread dto.Thread
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/threads/1", "", nil), http.StatusOK, &thread)
+	if thread.AcceptedCommentID == nil || *thread.AcceptedCommentID != better.ID {
+		t.Errorf("accepted_comment_id = %v, want %d", thread.AcceptedCommentID, better.ID)
+	}
+}
+
+func TestAcceptAnswerFromAnotherThread(t *testing.T) {
+	server := handlertest.New(t)
+	author, token := server.User("alice")
+
+	createThread(t, server, token, "First")
+	createThread(t, server, token, "Second")
+	comment := models.Comment{ThreadID: 2, UserID: author.ID, Content: "Elsewhere"}
+	if _, err := server.DB.Stores().Comments.Create(context.Background(), &comment); err != nil {
+		t.Fatal(err)
+	}
+
+	accept := dto.AcceptAnswerRequest{CommentID: &comment.ID}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/threads/1/accepted-comment", token, accept), http.StatusBadRequest, nil)
+}
+
+func TestAcceptAnswerConcurrently(t *testing.T) {
+	server := handlertest.New(t)
+	ctx := context.Background()
+	stores := server.DB.Stores()
+	_, askerToken := server.User("alice")
+	createThread(t, server, askerToken, "Question")
+
+	var answers []models.Comment
+	for _, name := range []string{"bob", "carol"} {
+		author, _ := server.User(name)
+		answer := models.Comment{ThreadID: 1, UserID: author.ID, Content: "An answer from " + name}
+		if _, err := stores.Comments.Create(ctx, &answer); err != nil {
+			t.Fatal(err)
+		}
+		answers = append(answers, answer)
+	}
+
+	// Requests switching the accepted answer back and forth must leave exactly one
+	// answer's worth of points, with the author of the accepted answer
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		answer := answers[i%len(answers)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := server.Do(http.MethodPut, "/api/v1/threads/1/accepted-comment", askerToken, dto.AcceptAnswerRequest{CommentID: &answer.ID})
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200; body: %s", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	thread, err := stores.Threads.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, answer := range answers {
+		profile, err := stores.Users.GetProfile(ctx, answer.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if *thread.AcceptedCommentID == answer.ID {
+			want = reputation.AcceptedAnswerPoints
+		}
+		if profile.Reputation != want {
+			t.Errorf("reputation of %s = %d, want %d", profile.Username, profile.Reputation, want)
+		}
+	}
+}
+
+// slowPostHistory makes returning a user's recent posts take a while, in the stores and in
+// the stores of their transactions, so that concurrent posts overlap between the spam
+// check and the insert
+func slowPostHistory(stores *store.Stores) *store.Stores {
+	slow := *stores
+	slow.Users = slowUsers{stores.Users}
+	slow.Transactor = slowTransactor{stores.Transactor}
+	return &slow
+}
+
+type slowUsers struct {
+	store.UserStore
+}
+
+func (s slowUsers) ListPostsSince(ctx context.Context, userID int, since time.Time, limit int) ([]models.Post, error) {
+	posts, err := s.UserStore.ListPostsSince(ctx, userID, since, limit)
+	time.Sleep(20 * time.Millisecond)
+	return posts, err
+}
+
+type slowTransactor struct {
+	store.Transactor
+}
+
+func (t slowTransactor) WithTx(ctx context.Context, fn func(tx *store.Stores) error) error {
+	return t.Transactor.WithTx(ctx, func(tx *store.Stores) error {
+		return fn(slowPostHistory(tx))
+	})
+}
+
+func TestCreateThreadsConcurrentlyWithCooldown(t *testing.T) {
+	server := handlertest.NewWithStores(t, slowPostHistory)
+	_, token := server.User("alice")
+	antispam.Configure(config.AntiSpam{MinPostInterval: time.Minute})
+	t.Cleanup(func() { antispam.Configure(config.AntiSpam{}) })
+
+	// Posts sent at once must not all pass the cooldown check before any is stored
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := make(map[int]int)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := server.Do(http.MethodPost, "/api/v1/threads", token, dto.ThreadCreateRequest{
+				Title:      "Question",
+				Content:    "Anyone?",
+				CategoryID: 1,
+			})
+			mu.Lock()
+			statuses[rec.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if statuses[http.StatusCreated] != 1 || statuses[http.StatusTooManyRequests] != 4 {
+		t.Errorf("statuses = %v, want one 201 and the rest 429", statuses)
+	}
+}
@@ -0,0 +1,260 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/mailer"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/blobfish465/common-circle-web-forum/internal/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const EmailVerificationTTL = 24 * time.Hour
+
+// Handles getting the profile of the authenticated user
+func HandleGetMe(r *http.Request) (*api.Response, error) {
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := store.From(r.Context()).Users.GetByID(r.Context(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	data, err := json.Marshal(dto.NewUser(*user))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user data: %w", err)
+	}
+
+	return &api.Response{
+		Payload: api.Payload{
+			Data: data,
+		},
+		Messages: []string{"User retrieved successfully"},
+	}, nil
+}
+
+// Handles editing the profile of the authenticated user. A new email address is not
+// applied straight away; a verification link is sent to it instead.
+func HandleUpdateMe(r *http.Request) (*api.Response, error) {
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := api.Decode[dto.UserUpdateRequest](r)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := store.From(r.Context())
+
+	user, err := stores.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if utf8.RuneCountInString(username) < 3 {
+			return nil, validation.Field("username", "must be at least 3 characters")
+		}
+		user.Username = username
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*req.AvatarURL)
+	}
+
+	var newEmail string
+	if req.Email != nil && !strings.EqualFold(strings.TrimSpace(*req.Email), user.Email) {
+		newEmail = strings.TrimSpace(*req.Email)
+	}
+
+	// The profile and a pending email change are saved together, so a taken
+	// address leaves the rest of the profile untouched
+	var token string
+	err = stores.WithTx(r.Context(), func(tx *store.Stores) error {
+		if newEmail != "" {
+			if err := checkEmailAvailable(r.Context(), tx, newEmail); err != nil {
+				return err
+			}
+		}
+		if err := tx.Users.UpdateProfile(r.Context(), user); err != nil {
+			return fmt.Errorf("failed to update profile: %w", err)
+		}
+		if newEmail == "" {
+			return nil
+		}
+		token, err = createEmailVerification(r.Context(), tx, user.ID, newEmail)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The profile and the pending change are already saved, so a failure to mail the link
+	// is reported rather than failing the request. Saving the address again resends it.
+	messages := []string{"Profile updated successfully"}
+	if newEmail != "" {
+		if err := sendEmailVerification(r.Context(), newEmail, token); err != nil {
+			logging.FromContext(r.Context()).Error("failed to send email verification", "error", err)
+			messages = append(messages, fmt.Sprintf("The verification link could not be sent to %s; save the address again to resend it", newEmail))
+		} else {
+			messages = append(messages, fmt.Sprintf("A verification link has been sent to %s", newEmail))
+		}
+	}
+
+	data, err := json.Marshal(dto.NewUser(*user))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user data: %w", err)
+	}
+
+	return &api.Response{
+		Payload: api.Payload{
+			Data: data,
+		},
+		Messages: messages,
+	}, nil
+}
+
+// checkEmailAvailable returns a conflict if another account already uses email
+func checkEmailAvailable(ctx context.Context, stores *store.Stores, email string) error {
+	_, err := stores.Users.GetByEmail(ctx, email)
+	if err == nil {
+		return apperrors.Conflict("email %s is already in use", email)
+	}
+	if !apperrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// createEmailVerification records a pending email change and returns the token to mail
+func createEmailVerification(ctx context.Context, stores *store.Stores, userID int, email string) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	err := stores.Verifications.Create(ctx, userID, email, hashToken(token), time.Now().Add(EmailVerificationTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to store email verification: %w", err)
+	}
+	return token, nil
+}
+
+// sendEmailVerification mails the verification link for a pending email change
+func sendEmailVerification(ctx context.Context, email, token string) error {
+	return mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Open the link below to use this address for your Common Circle account:\n\n%s?token=%s\n\nThe link expires in %s.",
+			mailer.VerificationURL(), token, EmailVerificationTTL),
+	})
+}
+
+// Handles confirming a pending email change with the token from the verification link
+func HandleVerifyEmail(r *http.Request) (*api.Response, error) {
+	req, err := api.Decode[dto.EmailVerifyRequest](r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token is used up only if the email changes, so an address taken in the meantime
+	// leaves it valid to try again
+	err = store.From(r.Context()).WithTx(r.Context(), func(tx *store.Stores) error {
+		verification, err := tx.Verifications.Consume(r.Context(), hashToken(req.Token))
+		if apperrors.IsNotFound(err) {
+			return apperrors.Validation("invalid or expired verification token")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve email verification: %w", err)
+		}
+		if time.Now().After(verification.ExpiresAt) {
+			return apperrors.Validation("invalid or expired verification token")
+		}
+
+		if err := tx.Users.UpdateEmail(r.Context(), verification.UserID, verification.Email); err != nil {
+			return fmt.Errorf("failed to update email: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.Response{
+		Messages: []string{"Email verified successfully"},
+	}, nil
+}
+
+// Handles changing the authenticated user's password, which requires their current password
+func HandleChangePassword(r *http.Request) (*api.Response, error) {
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := api.Decode[dto.PasswordChangeRequest](r)
+	if err != nil {
+		return nil, err
+	}
+
+	userStore := store.From(r.Context()).Users
+
+	user, err := userStore.GetByID(r.Context(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	// Accounts created through a sign-in provider have no password to change
+	if user.PasswordHash == "" {
+		return nil, apperrors.Forbidden("this account signs in through a linked provider and has no password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		return nil, apperrors.Forbidden("current password is incorrect")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := userStore.UpdatePasswordHash(r.Context(), userID, string(hashedPassword)); err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return &api.Response{
+		Messages: []string{"Password changed successfully"},
+	}, nil
+}
+
+// hashToken returns the hex SHA-256 of a verification token, which is what gets stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,15 +1,18 @@
 package users
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/blobfish465/common-circle-web-forum/internal/api"
-	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/users"
-	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
 	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 	"github.com/go-chi/chi/v5"
@@ -26,22 +29,17 @@ const (
 	ErrDecodeRequestBody       = "Failed to decode request body in %s"
 	ErrHashPassword            = "Failed to hash password in %s"
 	ErrCreateUser              = "Failed to create user in %s"
+	RecentActivityLimit        = 10
 )
 
 // ListUsers
-func HandleListUsers(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
-	db, err := database.GetDB()
-
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveDatabase, ListUsers))
-	}
-
-	users, err := users.List(db)
+func HandleListUsers(r *http.Request) (*api.Response, error) {
+	users, err := store.From(r.Context()).Users.List(r.Context())
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveUsers, ListUsers))
 	}
 
-	data, err := json.Marshal(users)
+	data, err := json.Marshal(dto.NewUserSummaries(users))
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrEncodeView, ListUsers))
 	}
@@ -54,31 +52,39 @@ func HandleListUsers(w http.ResponseWriter, r *http.Request) (*api.Response, err
 	}, nil
 }
 
-// Handles getting a user by id
-func HandleGetUserByID(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+// Handles getting the public profile of a user by id. The email address is only
+// included when the profile is requested by its owner or an admin.
+func HandleGetUserByID(r *http.Request) (*api.Response, error) {
 	// Extract user ID using path parameters
 	userIDStr := chi.URLParam(r, "id")
 	if userIDStr == "" {
-		return nil, fmt.Errorf("missing user ID")
+		return nil, apperrors.Validation("missing user ID")
 	}
 
 	// Convert the user ID string to an integer
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, apperrors.Validation("invalid user ID: %s", userIDStr)
 	}
 
-	db, err := database.GetDB()
+	userStore := store.From(r.Context()).Users
+
+	profile, err := userStore.GetProfile(r.Context(), userID)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to retrieve database")
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
 	}
 
-	user, err := users.GetUserByID(db, userID)
+	profile.RecentActivity, err = userStore.ListRecentActivity(r.Context(), userID, RecentActivityLimit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+		return nil, fmt.Errorf("failed to retrieve recent activity: %w", err)
 	}
 
-	data, err := json.Marshal(user)
+	canSeeEmail, err := isSelfOrAdmin(r.Context(), r, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(dto.NewUserProfile(*profile, canSeeEmail))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal user data: %w", err)
 	}
@@ -91,24 +97,34 @@ func HandleGetUserByID(w http.ResponseWriter, r *http.Request) (*api.Response, e
 	}, nil
 }
 
-// expected structure of the request body
-type UserCreateRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+// isSelfOrAdmin reports whether the requester, if signed in, is the given user or an admin
+func isSelfOrAdmin(ctx context.Context, r *http.Request, userID int) (bool, error) {
+	viewerID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		// Anonymous request
+		return false, nil
+	}
+	if viewerID == userID {
+		return true, nil
+	}
+
+	viewer, err := store.From(ctx).Users.GetByID(ctx, viewerID)
+	if apperrors.IsNotFound(err) {
+		// The token belongs to an account that has since been deleted
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve requesting user: %w", err)
+	}
+	return viewer.IsAdmin, nil
 }
 
 // Create a new user
-func HandleCreateUsers(w http.ResponseWriter, r *http.Request) (*api.Response, error) {
+func HandleCreateUsers(r *http.Request) (*api.Response, error) {
 	// Decode the incoming request body
-	var req UserCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf(ErrDecodeRequestBody, CreateUser))
-	}
-
-	// Validate required fields
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		return nil, fmt.Errorf("missing required fields: username, email, or password")
+	req, err := api.Decode[dto.UserCreateRequest](r)
+	if err != nil {
+		return nil, err
 	}
 
 	// Hash the password
@@ -117,20 +133,14 @@ func HandleCreateUsers(w http.ResponseWriter, r *http.Request) (*api.Response, e
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrHashPassword, CreateUser))
 	}
 
-	// Establish database connection
-	db, err := database.GetDB()
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf(ErrRetrieveDatabase, CreateUser))
-	}
-
-	// Create the user in the database
+	// Create the user in the store
 	newUser := models.User{
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: string(hashedPassword),
 	}
 
-	err = users.Create(db, &newUser)
+	err = store.From(r.Context()).Users.Create(r.Context(), &newUser)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf(ErrCreateUser, CreateUser))
 	}
@@ -140,30 +150,29 @@ func HandleCreateUsers(w http.ResponseWriter, r *http.Request) (*api.Response, e
 	}, nil
 }
 
-// Delete user from database
-func HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+// Delete user from database, which users can only do to their own account unless they are an admin
+func HandleDeleteUser(r *http.Request) (*api.Response, error) {
 	// Extract user ID using path parameters
 	userIDStr := chi.URLParam(r, "id")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
+		return nil, apperrors.Validation("invalid user ID: %s", userIDStr)
 	}
 
-	// database connection
-	db, err := database.GetDB()
+	allowed, err := isSelfOrAdmin(r.Context(), r, userID)
 	if err != nil {
-		http.Error(w, "Failed to connect to the database", http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	if !allowed {
+		return nil, apperrors.Forbidden("you are not authorized to delete this user")
 	}
 
-	// Call dataaccess function in dataaccess/user.go to delete the user
-	err = users.Delete(db, userID)
+	err = store.From(r.Context()).Users.Delete(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to delete user: %w", err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("User deleted successfully"))
-}
\ No newline at end of file
+	return &api.Response{
+		Messages: []string{"User deleted successfully"},
+	}, nil
+}
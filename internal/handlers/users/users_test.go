@@ -0,0 +1,280 @@
+package users_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/mailer"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+)
+
+func TestSignUpAndLogIn(t *testing.T) {
+	server := handlertest.New(t)
+
+	signUp := dto.UserCreateRequest{Username: "alice", Email: "alice@example.com", Password: "correct horse"}
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/users", "", signUp), http.StatusCreated, nil)
+
+	// Usernames and emails are unique
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/users", "", signUp), http.StatusConflict, nil)
+
+	rec := server.Do(http.MethodPost, "/api/v1/login", "", dto.LoginRequest{Username: "alice", Password: "wrong password"})
+	handlertest.Decode(t, rec, http.StatusUnauthorized, nil)
+
+	rec = server.Do(http.MethodPost, "/api/v1/login", "", dto.LoginRequest{Username: "alice", Password: "correct horse"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d, want 200; body: %s", rec.Code, rec.Body.String())
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil || login.Token == "" {
+		t.Fatalf("login response %q has no token: %v", rec.Body.String(), err)
+	}
+
+	var me dto.User
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/me", login.Token, nil), http.StatusOK, &me)
+	if me.Username != "alice" || me.Email != "alice@example.com" {
+		t.Errorf("me = %+v, want alice", me)
+	}
+}
+
+func TestSignUpValidation(t *testing.T) {
+	server := handlertest.New(t)
+
+	signUp := dto.UserCreateRequest{Username: "al", Email: "not an email", Password: "short"}
+	response := handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/users", "", signUp), http.StatusUnprocessableEntity, nil)
+	for _, field := range []string{"username", "email", "password"} {
+		if !handlertest.HasFieldError(response, field) {
+			t.Errorf("errors = %+v, want one for %s", response.Errors, field)
+		}
+	}
+}
+
+func TestGetUserShowsEmailOnlyToOwner(t *testing.T) {
+	server := handlertest.New(t)
+	_, ownerToken := server.User("alice")
+	_, otherToken := server.User("bob")
+
+	tests := []struct {
+		name      string
+		token     string
+		wantEmail string
+	}{
+		{"anonymous", "", ""},
+		{"other user", otherToken, ""},
+		{"owner", ownerToken, "alice@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var profile dto.UserProfile
+			handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/1", tt.token, nil), http.StatusOK, &profile)
+			if profile.Username != "alice" || profile.Email != tt.wantEmail {
+				t.Errorf("profile = %+v, want alice with email %q", profile, tt.wantEmail)
+			}
+		})
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/users/42", "", nil), http.StatusNotFound, nil)
+}
+
+func TestDeleteUser(t *testing.T) {
+	server := handlertest.New(t)
+	ctx := context.Background()
+	stores := server.DB.Stores()
+	author, _ := server.User("alice")
+	voter, voterToken := server.User("bob")
+	_, otherToken := server.User("carol")
+
+	thread := models.Thread{UserID: author.ID, CategoryID: 1, Title: "Question", Content: "Anyone?"}
+	if _, err := stores.Threads.Create(ctx, &thread); err != nil {
+		t.Fatal(err)
+	}
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads/1/upvote", voterToken, nil), http.StatusOK, nil)
+
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/users/2", otherToken, nil), http.StatusForbidden, nil)
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/users/2", voterToken, nil), http.StatusOK, nil)
+
+	if _, err := stores.Users.GetByID(ctx, voter.ID); err == nil {
+		t.Error("user still exists after being deleted")
+	}
+	// The points the deleted user gave are taken back along with their vote
+	profile, err := stores.Users.GetProfile(ctx, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Reputation != 0 {
+		t.Errorf("author reputation = %d, want 0 after the voter was deleted (was %d)", profile.Reputation, reputation.UpvotePoints)
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	displayName := "Alice A."
+	bio := "Reads a lot"
+	var me dto.User
+	handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token,
+		dto.UserUpdateRequest{DisplayName: &displayName, Bio: &bio}), http.StatusOK, &me)
+	if me.DisplayName != displayName || me.Bio != bio {
+		t.Errorf("me = %+v, want the new display name and bio", me)
+	}
+
+	server.User("bob")
+	taken := "bob"
+	handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token, dto.UserUpdateRequest{Username: &taken}), http.StatusConflict, nil)
+
+	for _, short := range []string{"al", "  al  "} {
+		response := handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token,
+			dto.UserUpdateRequest{Username: &short}), http.StatusUnprocessableEntity, nil)
+		if !handlertest.HasFieldError(response, "username") {
+			t.Errorf("errors for username %q = %+v, want one for username", short, response.Errors)
+		}
+	}
+}
+
+func TestUpdateMeWithTakenEmail(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+	other, _ := server.User("bob")
+
+	// A conflicting address rejects the whole update
+	displayName := "Alice A."
+	handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token,
+		dto.UserUpdateRequest{DisplayName: &displayName, Email: &other.Email}), http.StatusConflict, nil)
+
+	var me dto.User
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/me", token, nil), http.StatusOK, &me)
+	if me.DisplayName == displayName {
+		t.Errorf("display name = %q, want it unchanged after the conflict", me.DisplayName)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	server := handlertest.New(t)
+	user, token := server.User("alice")
+
+	// A new address only takes effect once it is verified
+	email := "alice@new.example.com"
+	var me dto.User
+	handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token, dto.UserUpdateRequest{Email: &email}), http.StatusOK, &me)
+	if me.Email != user.Email {
+		t.Errorf("email = %q right after the change, want %q until it is verified", me.Email, user.Email)
+	}
+
+	verificationToken := pendingEmailChange(t, server, user.ID, email)
+
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/verify-email", "", dto.EmailVerifyRequest{Token: "wrong"}), http.StatusBadRequest, nil)
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/verify-email", "", dto.EmailVerifyRequest{Token: verificationToken}), http.StatusOK, nil)
+
+	handlertest.Decode(t, server.Do(http.MethodGet, "/api/v1/me", token, nil), http.StatusOK, &me)
+	if me.Email != email {
+		t.Errorf("email = %q after verifying, want %q", me.Email, email)
+	}
+
+	// Each token works once
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/verify-email", "", dto.EmailVerifyRequest{Token: verificationToken}), http.StatusBadRequest, nil)
+}
+
+// pendingEmailChange stores a pending change of the user's email with a known token, as
+// the real token is only mailed
+func pendingEmailChange(t *testing.T, server *handlertest.Server, userID int, email string) string {
+	t.Helper()
+
+	const token = "known-token"
+	sum := sha256.Sum256([]byte(token))
+	err := server.DB.Stores().Verifications.Create(context.Background(), userID, email, hex.EncodeToString(sum[:]), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyTakenEmailKeepsToken(t *testing.T) {
+	server := handlertest.New(t)
+	user, _ := server.User("alice")
+	token := pendingEmailChange(t, server, user.ID, "shared@example.com")
+
+	// Someone else signs up with the address before alice confirms it
+	taker := dto.UserCreateRequest{Username: "bob", Email: "shared@example.com", Password: "correct horse"}
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/users", "", taker), http.StatusCreated, nil)
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/verify-email", "", dto.EmailVerifyRequest{Token: token}), http.StatusConflict, nil)
+
+	// Once the address is free again the same link still works
+	bob, err := server.DB.Stores().Users.GetByUsername(context.Background(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.DB.Stores().Users.Delete(context.Background(), bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/verify-email", "", dto.EmailVerifyRequest{Token: token}), http.StatusOK, nil)
+}
+
+func TestChangeEmailWhenMailFails(t *testing.T) {
+	// Point the mailer at a port nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	mailer.Configure(config.Mail{SMTPHost: "127.0.0.1", SMTPPort: port, From: "no-reply@example.com"})
+	t.Cleanup(func() { mailer.Configure(config.Mail{}) })
+
+	server := handlertest.New(t)
+	user, token := server.User("alice")
+
+	// The profile is saved and the user told to try again, rather than the request failing
+	email := "alice@new.example.com"
+	displayName := "Alice A."
+	var me dto.User
+	response := handlertest.Decode(t, server.Do(http.MethodPatch, "/api/v1/me", token,
+		dto.UserUpdateRequest{DisplayName: &displayName, Email: &email}), http.StatusOK, &me)
+	if me.DisplayName != displayName || me.Email != user.Email {
+		t.Errorf("me = %+v, want the new display name and the old email", me)
+	}
+	if !strings.Contains(strings.Join(response.Messages, " "), "could not be sent") {
+		t.Errorf("messages = %q, want one saying the link was not sent", response.Messages)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	wrong := dto.PasswordChangeRequest{CurrentPassword: "not it", NewPassword: "new password"}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/me/password", token, wrong), http.StatusForbidden, nil)
+
+	change := dto.PasswordChangeRequest{CurrentPassword: handlertest.Password, NewPassword: "new password"}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/me/password", token, change), http.StatusOK, nil)
+
+	rec := server.Do(http.MethodPost, "/api/v1/login", "", dto.LoginRequest{Username: "alice", Password: "new password"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("login with the new password: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestChangePasswordWithoutPassword(t *testing.T) {
+	server := handlertest.New(t)
+
+	// Accounts created through a sign-in provider have no password hash
+	user := models.User{Username: "alice", Email: "alice@example.com", EmailVerified: true}
+	if err := server.DB.Stores().Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+
+	change := dto.PasswordChangeRequest{CurrentPassword: "anything", NewPassword: "new password"}
+	handlertest.Decode(t, server.Do(http.MethodPut, "/api/v1/me/password", server.Token(user.ID), change), http.StatusForbidden, nil)
+}
@@ -0,0 +1,127 @@
+package votes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Handles upvoting a thread
+func HandleUpvoteThread(r *http.Request) (*api.Response, error) {
+	return handleVote(r, models.VoteTargetThread, true)
+}
+
+// Handles removing an upvote from a thread
+func HandleRemoveThreadUpvote(r *http.Request) (*api.Response, error) {
+	return handleVote(r, models.VoteTargetThread, false)
+}
+
+// Handles upvoting a comment
+func HandleUpvoteComment(r *http.Request) (*api.Response, error) {
+	return handleVote(r, models.VoteTargetComment, true)
+}
+
+// Handles removing an upvote from a comment
+func HandleRemoveCommentUpvote(r *http.Request) (*api.Response, error) {
+	return handleVote(r, models.VoteTargetComment, false)
+}
+
+// handleVote adds or removes the authenticated user's upvote on a thread or comment and
+// updates the author's reputation when the vote actually changed
+func handleVote(r *http.Request, target string, add bool) (*api.Response, error) {
+	targetID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.KindValidation, err, "invalid %s ID", target)
+	}
+
+	// Get user ID from request context (set by AuthMiddleware)
+	userID, err := middleware.CurrentUserID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := store.From(r.Context())
+
+	authorID, err := authorOf(r.Context(), stores, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if authorID == userID {
+		return nil, apperrors.Forbidden("you cannot vote on your own %s", target)
+	}
+
+	// The vote and the author's reputation change together or not at all
+	err = stores.WithTx(r.Context(), func(tx *store.Stores) error {
+		var changed bool
+		var err error
+		if add {
+			changed, err = tx.Votes.Add(r.Context(), userID, target, targetID)
+		} else {
+			changed, err = tx.Votes.Remove(r.Context(), userID, target, targetID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update vote: %w", err)
+		}
+
+		if changed {
+			points := reputation.UpvotePoints
+			if !add {
+				points = -points
+			}
+			if err := reputation.Award(r.Context(), tx.Reputation, authorID, points); err != nil {
+				return fmt.Errorf("failed to update reputation: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := stores.Votes.Count(r.Context(), target, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+
+	data, err := json.Marshal(dto.VoteSummary{Upvotes: count})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode vote data: %w", err)
+	}
+
+	message := "Upvote added"
+	if !add {
+		message = "Upvote removed"
+	}
+	return &api.Response{
+		Payload:  api.Payload{Data: data},
+		Messages: []string{message},
+	}, nil
+}
+
+// authorOf returns the ID of the user who posted a thread or comment
+func authorOf(ctx context.Context, stores *store.Stores, target string, targetID int) (int, error) {
+	if target == models.VoteTargetThread {
+		thread, err := stores.Threads.GetByID(ctx, targetID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch thread: %w", err)
+		}
+		return thread.UserID, nil
+	}
+
+	comment, err := stores.Comments.GetByID(ctx, targetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch comment: %w", err)
+	}
+	return comment.UserID, nil
+}
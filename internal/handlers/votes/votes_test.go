@@ -0,0 +1,109 @@
+package votes_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/dto"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/handlertest"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+)
+
+func reputationOf(t *testing.T, server *handlertest.Server, userID int) int {
+	t.Helper()
+
+	profile, err := server.DB.Stores().Users.GetProfile(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile.Reputation
+}
+
+func TestUpvoteThread(t *testing.T) {
+	server := handlertest.New(t)
+	author, _ := server.User("alice")
+	_, voterToken := server.User("bob")
+	thread := models.Thread{UserID: author.ID, CategoryID: 1, Title: "Question", Content: "Anyone?"}
+	if _, err := server.DB.Stores().Threads.Create(context.Background(), &thread); err != nil {
+		t.Fatal(err)
+	}
+
+	var summary dto.VoteSummary
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads/1/upvote", voterToken, nil), http.StatusOK, &summary)
+	if summary.Upvotes != 1 {
+		t.Errorf("upvotes = %d, want 1", summary.Upvotes)
+	}
+	if got := reputationOf(t, server, author.ID); got != reputation.UpvotePoints {
+		t.Errorf("author reputation = %d, want %d", got, reputation.UpvotePoints)
+	}
+
+	// Upvoting again changes nothing
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads/1/upvote", voterToken, nil), http.StatusOK, &summary)
+	if summary.Upvotes != 1 {
+		t.Errorf("upvotes after voting twice = %d, want 1", summary.Upvotes)
+	}
+	if got := reputationOf(t, server, author.ID); got != reputation.UpvotePoints {
+		t.Errorf("author reputation after voting twice = %d, want %d", got, reputation.UpvotePoints)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodDelete, "/api/v1/threads/1/upvote", voterToken, nil), http.StatusOK, &summary)
+	if summary.Upvotes != 0 {
+		t.Errorf("upvotes after removing = %d, want 0", summary.Upvotes)
+	}
+	if got := reputationOf(t, server, author.ID); got != 0 {
+		t.Errorf("author reputation after removing = %d, want 0", got)
+	}
+}
+
+func TestUpvoteComment(t *testing.T) {
+	server := handlertest.New(t)
+	author, _ := server.User("alice")
+	_, voterToken := server.User("bob")
+	stores := server.DB.Stores()
+	thread := models.Thread{UserID: author.ID, CategoryID: 1, Title: "Question", Content: "Anyone?"}
+	if _, err := stores.Threads.Create(context.Background(), &thread); err != nil {
+		t.Fatal(err)
+	}
+	comment := models.Comment{ThreadID: thread.ID, UserID: author.ID, Content: "Bump"}
+	if _, err := stores.Comments.Create(context.Background(), &comment); err != nil {
+		t.Fatal(err)
+	}
+
+	var summary dto.VoteSummary
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/comments/1/upvote", voterToken, nil), http.StatusOK, &summary)
+	if summary.Upvotes != 1 {
+		t.Errorf("upvotes = %d, want 1", summary.Upvotes)
+	}
+
+	// Deleting the thread removes the comment along with its votes
+	if err := stores.Threads.Delete(context.Background(), thread.ID); err != nil {
+		t.Fatal(err)
+	}
+	count, err := stores.Votes.Count(context.Background(), models.VoteTargetComment, comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("votes on the deleted comment = %d, want 0", count)
+	}
+}
+
+func TestUpvoteOwnPost(t *testing.T) {
+	server := handlertest.New(t)
+	author, token := server.User("alice")
+	thread := models.Thread{UserID: author.ID, CategoryID: 1, Title: "Question", Content: "Anyone?"}
+	if _, err := server.DB.Stores().Threads.Create(context.Background(), &thread); err != nil {
+		t.Fatal(err)
+	}
+
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads/1/upvote", token, nil), http.StatusForbidden, nil)
+}
+
+func TestUpvoteMissingThread(t *testing.T) {
+	server := handlertest.New(t)
+	_, token := server.User("alice")
+
+	handlertest.Decode(t, server.Do(http.MethodPost, "/api/v1/threads/42/upvote", token, nil), http.StatusNotFound, nil)
+}
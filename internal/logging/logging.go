@@ -0,0 +1,72 @@
+// Package logging sets up structured logging with log/slog. Records carry the ID of the
+// request they were logged for, and credentials and tokens are redacted before they are
+// written, whichever attribute they end up in.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup installs the default logger, writing to stderr at the configured minimum level
+// and format. Messages written with the standard log package go through it too.
+func Setup(cfg config.Log) {
+	slog.SetDefault(New(os.Stderr, cfg.Level, cfg.Format))
+}
+
+// New returns a logger that writes records at level or above to w, redacting secrets
+func New(w io.Writer, level string, format string) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redactAttr,
+	}
+	if strings.EqualFold(format, "text") {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the default logger, with the request ID and trace of ctx attached when it has them
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	// Records logged during a sampled trace can be found from the trace, and the other way round
+	if span := trace.SpanContextFromContext(ctx); span.IsSampled() {
+		logger = logger.With("trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
+	}
+	return logger
+}
@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// sendTimeout bounds sending a message when the context has no deadline of its own
+const sendTimeout = 30 * time.Second
+
+// settings is the mail configuration given to Configure
+var settings = config.Mail{
+	SMTPPort:        587,
+	From:            "no-reply@commoncircle.local",
+	VerificationURL: "http://localhost:3000/verify-email",
+}
+
+// Configure sets the SMTP server and addresses used to send mail
+func Configure(cfg config.Mail) {
+	settings = cfg
+}
+
+// VerificationURL returns the frontend page that confirms a new email address
+func VerificationURL() string {
+	return settings.VerificationURL
+}
+
+// Send delivers a message through the configured SMTP server. When no server is
+// configured, as in local development, only its recipient and subject are logged, as the
+// body may hold a verification token.
+func Send(ctx context.Context, msg Message) (err error) {
+	host := settings.SMTPHost
+	if host == "" {
+		logging.FromContext(ctx).Warn("SMTP_HOST is not set, not sending mail", "to", msg.To, "subject", msg.Subject)
+		return nil
+	}
+
+	_, span := tracing.Tracer.Start(ctx, "mailer.Send", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(host), semconv.ServerPort(settings.SMTPPort)))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	from := settings.From
+	body := strings.Join([]string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	if err := send(ctx, host, from, msg.To, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// send delivers a message like smtp.SendMail, but gives up when ctx is done or its
+// deadline passes, or after sendTimeout if it has none
+func send(ctx context.Context, host, from, to string, message []byte) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	defer func() {
+		// The connection's deadline is the context's, so a timeout means the context is
+		// ending. Report that rather than the I/O error it caused.
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			<-ctx.Done()
+			err = ctx.Err()
+		}
+	}()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(settings.SMTPPort)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The deadline bounds every read and write; cancelling ctx moves it to now
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if settings.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", settings.SMTPUsername, settings.SMTPPassword, host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,115 @@
+package mailer_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/mailer"
+)
+
+// listen starts a TCP listener for a fake SMTP server and points the mailer at it
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	mailer.Configure(config.Mail{
+		SMTPHost: "127.0.0.1",
+		SMTPPort: listener.Addr().(*net.TCPAddr).Port,
+		From:     "no-reply@example.com",
+	})
+	t.Cleanup(func() { mailer.Configure(config.Mail{}) })
+	return listener
+}
+
+// serveSMTP answers one client with the replies of a server that accepts every message,
+// and returns the message data it received
+func serveSMTP(listener net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(received)
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250 fake")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 queued")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				received <- data.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func TestSend(t *testing.T) {
+	received := serveSMTP(listen(t))
+
+	err := mailer.Send(context.Background(), mailer.Message{To: "alice@example.com", Subject: "Hello", Body: "Hi Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := <-received
+	if !strings.Contains(data, "To: alice@example.com") || !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "Hi Alice") {
+		t.Errorf("message data = %q, want the recipient, subject and body", data)
+	}
+}
+
+func TestSendStopsAtContextDeadline(t *testing.T) {
+	// The server accepts the connection but never greets the client
+	listener := listen(t)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := mailer.Send(ctx, mailer.Message{To: "alice@example.com", Subject: "Hello", Body: "Hi Alice"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send returned %v, want the context's deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send took %s, want it to stop at the context's deadline", elapsed)
+	}
+}
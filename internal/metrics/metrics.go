@@ -0,0 +1,32 @@
+// Package metrics serves the Prometheus metrics registered with client_golang's default
+// registry, which also holds the Go runtime and process metrics. Metrics are registered
+// once, at package initialization, and live for the whole process.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler serves every registered metric. When token is set, only requests bearing it
+// are served.
+func Handler(token string) http.Handler {
+	handler := promhttp.Handler()
+	if token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			api.WriteError(w, r, apperrors.Unauthorized("Invalid or missing metrics token"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -3,15 +3,16 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
-	"log" 
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
 	"github.com/blobfish465/common-circle-web-forum/internal/utils"
 )
 
-var jwtSecret = utils.GetJWTSecret()
-
 // Claims defines the structure of the JWT payload
 type Claims struct {
 	UserID string `json:"user_id"`
@@ -23,33 +24,75 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract the token from the "Authorization" header
 		authHeader := r.Header.Get("Authorization")
-		log.Println("Authorization Header:", authHeader) 
 		if authHeader == "" {
-			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+			api.WriteError(w, r, apperrors.Unauthorized("Missing Authorization header"))
 			return
 		}
 
-		// Ensure the token follows the "Bearer <token>" format
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+		claims, err := parseAuthorizationHeader(authHeader)
+		if err != nil {
+			api.WriteError(w, r, err)
 			return
 		}
-		tokenStr := tokenParts[1]
-
-		// Parse and validate the token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		logging.FromContext(r.Context()).Debug("authenticated request", "user_id", claims.UserID)
+
+		// Attach the user ID to the request context
+		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalAuthMiddleware attaches the user ID to the request context when a valid token is
+// sent, and lets the request through anonymously otherwise. It is for public routes whose
+// response depends on who is asking.
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := parseAuthorizationHeader(authHeader)
+		if err != nil {
+			next.ServeHTTP(w, r)
 			return
 		}
-		log.Printf("Authenticated User ID: %s\n", claims.UserID)
 
-		// Attach the user ID to the request context
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// parseAuthorizationHeader validates a "Bearer <token>" header and returns the token's claims
+func parseAuthorizationHeader(authHeader string) (*Claims, error) {
+	// Ensure the token follows the "Bearer <token>" format
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
+		return nil, apperrors.Unauthorized("Invalid Authorization header format")
+	}
+	tokenStr := tokenParts[1]
+
+	// Parse and validate the token
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return utils.GetJWTSecret(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, apperrors.Unauthorized("Invalid or expired token")
+	}
+	return claims, nil
+}
+
+// CurrentUserID returns the ID of the user authenticated by AuthMiddleware or OptionalAuthMiddleware
+func CurrentUserID(r *http.Request) (int, error) {
+	userIDStr, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		return 0, apperrors.Unauthorized("User ID is invalid")
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, apperrors.Unauthorized("User ID is invalid")
+	}
+	return userID, nil
+}
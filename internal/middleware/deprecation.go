@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+)
+
+// DeprecationHeaders are the response headers that announce a deprecated route and its
+// replacement, which browsers may read from other origins
+var DeprecationHeaders = []string{"Deprecation", "Sunset", "Link"}
+
+// Deprecated marks the routes it wraps as deprecated since deprecatedAt and removed at
+// sunset, with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers. The same path
+// under successor is linked as the successor version. From the sunset on, requests are
+// answered with 410 Gone instead of being passed to the routes.
+func Deprecated(deprecatedAt, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("Deprecation", deprecation)
+			header.Set("Sunset", sunsetDate)
+			header.Add("Link", "<"+successor+r.URL.EscapedPath()+`>; rel="successor-version"`)
+
+			// The sunset is checked on every request, as the server may run past it
+			if !time.Now().Before(sunset) {
+				api.WriteError(w, r, apperrors.Gone("This route was removed on %s, use %s instead", sunsetDate, successor+r.URL.EscapedPath()))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+	"github.com/blobfish465/common-circle-web-forum/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RateLimitHeaders are the response headers that tell clients how close they are to a
+// limit, which browsers may read from other origins
+var RateLimitHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
+
+var rateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limit_rejections_total",
+	Help: "Requests rejected for exceeding a rate limit, by route group.",
+}, []string{"group"})
+
+// RateLimits holds the rate limit middleware of each group of routes
+type RateLimits struct {
+	// Auth limits logging in and signing up, Write the routes that change data and Read the rest
+	Auth, Write, Read func(http.Handler) http.Handler
+}
+
+// NewRateLimits returns the middleware limiting each group of routes to its configured
+// rate, with buckets kept in store. A nil store disables rate limiting.
+func NewRateLimits(cfg config.RateLimit, store ratelimit.Store) RateLimits {
+	if store == nil {
+		return RateLimits{Auth: passThrough, Write: passThrough, Read: passThrough}
+	}
+	return RateLimits{
+		Auth:  RateLimit(ratelimit.NewLimiter("auth", cfg.Auth, store), cfg.TrustProxy),
+		Write: RateLimit(ratelimit.NewLimiter("write", cfg.Write, store), cfg.TrustProxy),
+		Read:  RateLimit(ratelimit.NewLimiter("read", cfg.Read, store), cfg.TrustProxy),
+	}
+}
+
+func passThrough(next http.Handler) http.Handler {
+	return next
+}
+
+// RateLimit limits each user to the limiter's rate, or each client IP for requests that
+// are not authenticated, so it must come after AuthMiddleware to count by user. Every
+// response carries RateLimit-* headers, and rejected requests get 429 Too Many Requests
+// with Retry-After. If the limiter's store fails, requests are let through.
+func RateLimit(limiter *ratelimit.Limiter, trustProxy bool) func(http.Handler) http.Handler {
+	rate := limiter.Rate()
+	policy := strconv.Itoa(rate.Requests) + ";w=" + strconv.Itoa(int(math.Ceil(rate.Per.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + clientIP(r, trustProxy)
+			if userID, err := CurrentUserID(r); err == nil {
+				key = "user:" + strconv.Itoa(userID)
+			}
+
+			decision, err := limiter.Allow(r.Context(), key)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("rate limit check failed, allowing the request",
+					"group", limiter.Name(), "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", seconds(decision.Reset))
+			header.Set("RateLimit-Policy", policy)
+
+			if !decision.Allowed {
+				rateLimitRejections.WithLabelValues(limiter.Name()).Inc()
+				retryAfter := seconds(decision.RetryAfter)
+				header.Set("Retry-After", retryAfter)
+				api.WriteError(w, r, apperrors.RateLimited("Too many requests, try again in %s seconds", retryAfter))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds formats d as whole seconds, rounded up so that clients do not retry too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// clientIP returns the IP of the client. With trustProxy, it is the last address in
+// X-Forwarded-For, which is the one added by the proxy in front of the server; the
+// earlier ones are as the client sent them.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/logging"
+)
+
+// RequestIDHeader carries the request ID, both from clients or proxies that already
+// assigned one and back to the client in the response
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits incoming request IDs to something safe to log and echo back
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,128}$`)
+
+// RequestID attaches an ID to each request, reusing a well-formed X-Request-ID header if
+// there is one, so every log record written while handling it can be tied together
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the time just in case
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs each request once it has been handled. Only the path is logged, as query
+// strings can hold credentials such as OAuth codes. Successful requests to routes marked
+// with Quiet are logged at debug level only.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		quiet := new(bool)
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), quietKey{}, quiet)))
+
+		level := slog.LevelInfo
+		if *quiet && recorder.status < http.StatusBadRequest {
+			level = slog.LevelDebug
+		}
+		logging.FromContext(r.Context()).Log(r.Context(), level, "request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+type quietKey struct{}
+
+// Quiet marks routes polled so often, such as health probes, that AccessLog would drown
+// out everything else if it logged each success
+func Quiet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if quiet, ok := r.Context().Value(quietKey{}).(*bool); ok {
+			*quiet = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
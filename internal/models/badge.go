@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Badge is an achievement from the badge catalog
+type Badge struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// UserBadge is a badge that has been awarded to a user
+type UserBadge struct {
+	Badge
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// ActivityStats summarises a user's participation, used to decide which badges they have earned
+type ActivityStats struct {
+	UserID       int
+	ThreadCount  int
+	CommentCount int
+	MemberDays   int
+}
@@ -1,10 +1,12 @@
 package models
 
+import "time"
+
 type Comment struct {
 	ID        int    `json:"id"`
 	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // nil until the comment is edited
 	UserID int `json:"user_id"`
 	ThreadID  int    `json:"thread_id"`
 }
\ No newline at end of file
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// EmailVerification is a pending change of a user's email address, confirmed by a token sent to the new address.
+type EmailVerification struct {
+	UserID    int
+	Email     string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LinkedIdentity connects a local user to an account at an external OpenID Connect provider.
+type LinkedIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Post is a thread or comment as the anti-spam rules see it, with its full content
+type Post struct {
+	Type      string // "thread" or "comment"
+	ID        int
+	Content   string
+	CreatedAt time.Time
+}
@@ -1,11 +1,16 @@
 package models
 
+import "time"
+
 type Thread struct {
 	ID        int    `json:"id"`
 	UserID    int    `json:"user_id"`
 	Title     string `json:"title"`
 	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // nil until the thread is edited
 	CategoryID int `json:"category_id"`
+	AcceptedCommentID *int `json:"accepted_comment_id,omitempty"`
+	AuthorUsername string `json:"author_username,omitempty"`
+	AuthorReputation int `json:"author_reputation"`
 }
\ No newline at end of file
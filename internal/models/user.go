@@ -1,13 +1,21 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type User struct {
 	ID   int    `json:"id"`
 	Username string `json:"username"`
 	Email string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio string `json:"bio,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	IsAdmin bool `json:"is_admin,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 	PasswordHash string `json:"-"` // Not serialized when sent over JSON
-	Password      string `json:"password,omitempty"` // Used only for binding incoming JSON data
 }
 
 func (user *User) Greet() string {
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UserProfile is the view of a user shown to other members. Email is only filled in
+// when the profile is viewed by its owner or an admin.
+type UserProfile struct {
+	ID             int        `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email,omitempty"`
+	DisplayName    string     `json:"display_name,omitempty"`
+	Bio            string     `json:"bio,omitempty"`
+	AvatarURL      string     `json:"avatar_url,omitempty"`
+	JoinedAt       time.Time  `json:"joined_at"`
+	ThreadCount    int        `json:"thread_count"`
+	CommentCount   int        `json:"comment_count"`
+	Reputation     int        `json:"reputation"`
+	RecentActivity []Activity `json:"recent_activity"`
+}
+
+// Activity is a thread or comment posted by a user, as listed on their profile
+type Activity struct {
+	Type        string    `json:"type"` // "thread" or "comment"
+	ID          int       `json:"id"`
+	ThreadID    int       `json:"thread_id"`
+	ThreadTitle string    `json:"thread_title"`
+	Excerpt     string    `json:"excerpt"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// Targets that can be upvoted
+const (
+	VoteTargetThread  = "thread"
+	VoteTargetComment = "comment"
+)
@@ -0,0 +1,24 @@
+package openapi_test
+
+import (
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/openapi"
+	"github.com/blobfish465/common-circle-web-forum/internal/router"
+	"github.com/blobfish465/common-circle-web-forum/internal/store/memory"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	limits := middleware.NewRateLimits(config.RateLimit{Store: "none"}, nil)
+	handler := router.Setup(memory.New().Stores(), config.CORS{}, config.API{}, config.Metrics{Token: "metrics-token"}, limits)
+
+	undocumented, err := openapi.Undocumented(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range undocumented {
+		t.Errorf("%s is missing from openapi.json", route)
+	}
+}
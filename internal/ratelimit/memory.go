@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+)
+
+// sweepInterval is how often stores delete the buckets that have refilled, which hold
+// nothing a new bucket would not
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in memory. Each server has its own, so with several instances
+// a client gets the limit on each of them; use PostgresStore to share one.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled, after which it can be deleted
+	full time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate config.Rate) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for key, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	capacity := float64(rate.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*perSecond(rate)
+	if tokens > capacity {
+		tokens = capacity
+	}
+	if tokens < 1 {
+		// Leave the bucket as it is, so its refill carries on from the last token taken
+		return tokens, false, nil
+	}
+
+	b.tokens = tokens - 1
+	b.updated = now
+	b.full = now.Add(time.Duration((capacity - b.tokens) * float64(refillInterval(rate))))
+	return b.tokens, true, nil
+}
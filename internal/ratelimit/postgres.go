@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/ratelimits"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+)
+
+// idleBucketTTL is how long a bucket is kept after its last token was taken. Rates are
+// limited to periods of a day, so every bucket has refilled by then.
+const idleBucketTTL = 24 * time.Hour
+
+// PostgresStore keeps buckets in the database, so every instance of the server shares them
+type PostgresStore struct {
+	db *database.Database
+	// lastSweep is when idle buckets were last deleted, in Unix nanoseconds
+	lastSweep atomic.Int64
+}
+
+// NewPostgresStore returns a store that keeps buckets in db
+func NewPostgresStore(db *database.Database) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, rate config.Rate) (float64, bool, error) {
+	s.sweep(ctx)
+	return ratelimits.Take(ctx, s.db, key, float64(rate.Requests), perSecond(rate))
+}
+
+// sweep deletes idle buckets, at most once per sweepInterval across all requests
+func (s *PostgresStore) sweep(ctx context.Context) {
+	now := time.Now()
+	last := s.lastSweep.Load()
+	if now.Sub(time.Unix(0, last)) < sweepInterval || !s.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	if _, err := ratelimits.DeleteIdle(ctx, s.db, idleBucketTTL); err != nil {
+		slog.Warn("failed to delete idle rate limit buckets", "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package ratelimit limits how often a client may call the API with token buckets. Each
+// client has a bucket per limit that holds up to Rate.Requests tokens and refills evenly
+// over Rate.Per; a request takes a token and is rejected when there is none left.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+)
+
+// Store keeps token buckets by key
+type Store interface {
+	// Take refills the bucket with the given key for the time since it was last used and
+	// removes a token if there is a whole one left. It returns the tokens left and whether
+	// one was taken. A bucket that does not exist yet starts full.
+	Take(ctx context.Context, key string, rate config.Rate) (tokens float64, allowed bool, err error)
+}
+
+// Decision is the outcome of a request against a limit, with what the client needs to
+// know to stay under it
+type Decision struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining the whole tokens left in it
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed, if this one was not
+	RetryAfter time.Duration
+}
+
+// Limiter applies one rate to every client, each with its own bucket
+type Limiter struct {
+	name  string
+	rate  config.Rate
+	store Store
+}
+
+// NewLimiter returns a limiter whose buckets are kept in store under keys prefixed with name
+func NewLimiter(name string, rate config.Rate, store Store) *Limiter {
+	return &Limiter{name: name, rate: rate, store: store}
+}
+
+// Name identifies the limiter, e.g. in logs and metrics
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Rate is the rate the limiter allows each client
+func (l *Limiter) Rate() config.Rate {
+	return l.rate
+}
+
+// Allow takes a token from the bucket of the client identified by key
+func (l *Limiter) Allow(ctx context.Context, key string) (Decision, error) {
+	tokens, allowed, err := l.store.Take(ctx, l.name+":"+key, l.rate)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	perToken := refillInterval(l.rate)
+	decision := Decision{
+		Allowed:   allowed,
+		Limit:     l.rate.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(l.rate.Requests) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		decision.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return decision, nil
+}
+
+// refillInterval is how long a bucket takes to gain one token
+func refillInterval(rate config.Rate) time.Duration {
+	return rate.Per / time.Duration(rate.Requests)
+}
+
+// perSecond is how many tokens a bucket gains each second
+func perSecond(rate config.Rate) float64 {
+	return float64(rate.Requests) / rate.Per.Seconds()
+}
@@ -0,0 +1,78 @@
+package reputation
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+// Points awarded for each kind of contribution
+const (
+	UpvotePoints            = 10 // per upvote received on a thread or comment
+	AcceptedAnswerPoints    = 15 // per comment accepted as the answer to someone else's thread
+	LongevityPointsPerMonth = 1  // per full month of membership, awarded by the nightly reconciliation
+
+	reconcileTimeout = 10 * time.Minute
+)
+
+// Award applies a reputation change as it happens, e.g. when an upvote is added or removed.
+// Changes that are missed, such as points from deleted content, are corrected by Reconcile.
+func Award(ctx context.Context, reputations store.ReputationStore, userID int, points int) error {
+	return reputations.Adjust(ctx, userID, points)
+}
+
+// RevokeAwardedBy takes back the points a user gave others through upvotes and accepted
+// answers. Call it in the same transaction as deleting the user.
+func RevokeAwardedBy(ctx context.Context, db *database.Database, userID int) error {
+	return reputation.Revoke(ctx, db, userID, UpvotePoints, AcceptedAnswerPoints)
+}
+
+// Reconcile recomputes all reputations from the underlying votes, accepted answers and join dates
+func Reconcile(ctx context.Context, db *database.Database) error {
+	start := time.Now()
+	updated, err := reputation.Recalculate(ctx, db, UpvotePoints, AcceptedAnswerPoints, LongevityPointsPerMonth)
+	if err != nil {
+		return err
+	}
+	slog.Info("reputation reconciled", "users", updated, "duration", time.Since(start).String())
+	return nil
+}
+
+// RunNightly reconciles reputations once a day at the given hour (UTC) until ctx is
+// cancelled, so it is meant to be started in its own goroutine.
+func RunNightly(ctx context.Context, hour int) {
+	for {
+		timer := time.NewTimer(time.Until(nextRun(time.Now().UTC(), hour)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		db, err := database.GetDB()
+		if err != nil {
+			slog.Error("reputation reconciliation skipped, database unavailable", "error", err)
+			continue
+		}
+		// The reconciliation is one large query, so it gets longer than a request would
+		reconcileDB := *db
+		reconcileDB.QueryTimeout = reconcileTimeout
+		if err := Reconcile(ctx, &reconcileDB); err != nil {
+			slog.Error("reputation reconciliation failed", "error", err)
+		}
+	}
+}
+
+// nextRun returns the first time after now at the given hour
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -1,39 +1,82 @@
 package router
 
 import (
+	"time"
+
 	"github.com/rs/cors"
 	"github.com/go-chi/chi/v5"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/health"
+	"github.com/blobfish465/common-circle-web-forum/internal/metrics"
 	"github.com/blobfish465/common-circle-web-forum/internal/routes"
 	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
 )
 
-func Setup() chi.Router {
+// apiV1 is where version 1 of the API is mounted
+const apiV1 = "/api/v1"
+
+// legacyDeprecatedAt is when the unversioned routes were deprecated in favour of /api/v1
+var legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// Setup returns the router, with handlers reading and writing through stores, browsers
+// on the origins in corsConfig allowed to call it, each group of routes rate limited by
+// limits and the unversioned aliases of the API served until the sunset in apiConfig.
+// The metrics are served on /metrics only when metricsConfig has a token and no address
+// of their own.
+func Setup(stores *store.Stores, corsConfig config.CORS, apiConfig config.API, metricsConfig config.Metrics, limits middleware.RateLimits) chi.Router {
 	// initialize router
 	r := chi.NewRouter()
 
+	// Tag every request with an ID and trace it, then log it and record its metrics once handled
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Tracing)
+	r.Use(middleware.AccessLog)
+	r.Use(middleware.Metrics)
+
 	// To allow cross origin requests, between localhost3000 frontend and localhost8000 backend
 	// set up CORS(Cross-Origin Resource Sharing) middleware
 	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"https://unique-brioche-acdf26.netlify.app"}, // Frontend URL
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedOrigins:   corsConfig.AllowedOrigins, // Frontend URLs
+		AllowedMethods:   corsConfig.AllowedMethods,
+		AllowedHeaders:   corsConfig.AllowedHeaders,
+		ExposedHeaders:   exposedHeaders(),
+		MaxAge:           int(corsConfig.MaxAge / time.Second),
 		AllowCredentials: true, // Allow cookies and other credentials
 	})
 
 	// Apply CORS middleware
 	r.Use(corsMiddleware.Handler)
 
-	setUpRoutes(r)
+	// Make the stores available to the handlers
+	r.Use(store.Middleware(stores))
+
+	setUpRoutes(r, apiConfig, metricsConfig, limits)
 	return r
 }
 
-func setUpRoutes(r chi.Router) {
-	// Public routes (no authentication needed)
-	r.Group(routes.GetPublicRoutes())
+// exposedHeaders are the response headers browsers may read from other origins
+func exposedHeaders() []string {
+	headers := []string{middleware.RequestIDHeader}
+	headers = append(headers, middleware.RateLimitHeaders...)
+	return append(headers, middleware.DeprecationHeaders...)
+}
+
+func setUpRoutes(r chi.Router, apiConfig config.API, metricsConfig config.Metrics, limits middleware.RateLimits) {
+	// Probes and metrics for the deployment platform, outside any API version. The probes
+	// need no authentication; the metrics need their bearer token.
+	r.With(middleware.Quiet).Get("/healthz", health.HandleLiveness)
+	r.With(middleware.Quiet).Get("/readyz", health.HandleReadiness)
+	if metricsConfig.Token != "" && metricsConfig.Addr == "" {
+		r.With(middleware.Quiet).Method("GET", "/metrics", metrics.Handler(metricsConfig.Token))
+	}
+
+	r.Route(apiV1, routes.V1.Routes(limits))
 
-	// Secured routes (requires authentication)
+	// The routes were first served at the root, where clients written before /api/v1 still
+	// call them. They stay there, marked as deprecated, and answer 410 Gone after the sunset.
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware) // Apply JWT authentication middleware
-		routes.GetPrivateRoutes(r)      // Define secured routes here
+		r.Use(middleware.Deprecated(legacyDeprecatedAt, apiConfig.LegacySunset, apiV1))
+		routes.V1.Routes(limits)(r)
 	})
 }
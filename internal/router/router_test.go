@@ -0,0 +1,212 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
+	"github.com/blobfish465/common-circle-web-forum/internal/config"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/router"
+	"github.com/blobfish465/common-circle-web-forum/internal/store/memory"
+)
+
+// newRouter sets up the router with the default CORS settings, allowing the given origins
+func newRouter(origins ...string) http.Handler {
+	corsConfig := config.CORS{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+	apiConfig := config.API{LegacySunset: time.Now().Add(365 * 24 * time.Hour)}
+	limits := middleware.NewRateLimits(config.RateLimit{Store: "none"}, nil)
+	return router.Setup(memory.New().Stores(), corsConfig, apiConfig, config.Metrics{}, limits)
+}
+
+// preflight sends the OPTIONS request a browser makes before a cross origin request, which
+// lists the headers it will send in lowercase and sorted
+func preflight(handler http.Handler, path string, origin string, method string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	req.Header.Set("Access-Control-Request-Headers", "authorization,content-type")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := newRouter("https://forum.example.com", "https://*.netlify.app")
+
+	tests := []struct {
+		name    string
+		path    string
+		origin  string
+		method  string
+		allowed bool
+	}{
+		{"allowed origin", "/api/v1/me", "https://forum.example.com", http.MethodPatch, true},
+		{"allowed subdomain", "/api/v1/threads/1", "https://preview--forum.netlify.app", http.MethodPatch, true},
+		{"legacy route", "/me", "https://forum.example.com", http.MethodPatch, true},
+		{"other origin", "/api/v1/me", "https://evil.example.com", http.MethodPatch, false},
+		{"lookalike origin", "/api/v1/me", "https://forum.example.com.evil.test", http.MethodPatch, false},
+		{"method not allowed", "/api/v1/me", "https://forum.example.com", "TRACE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := preflight(handler, tt.path, tt.origin, tt.method)
+			header := rec.Header()
+
+			if rec.Code >= 300 {
+				t.Errorf("status = %d, want a success status", rec.Code)
+			}
+			if !tt.allowed {
+				if got := header.Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+				}
+				return
+			}
+
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.method {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.method)
+			}
+			if got := strings.ToLower(header.Get("Access-Control-Allow-Headers")); !strings.Contains(got, "content-type") || !strings.Contains(got, "authorization") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want Content-Type and Authorization", got)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+			}
+			if got := header.Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+			}
+		})
+	}
+}
+
+func TestCORSPreflightWithUnlistedHeader(t *testing.T) {
+	handler := newRouter("https://forum.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/me", nil)
+	req.Header.Set("Origin", "https://forum.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	req.Header.Set("Access-Control-Request-Headers", "x-not-allowed")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none for a header that is not allowed", got)
+	}
+}
+
+func TestCORSExposesHeaders(t *testing.T) {
+	handler := newRouter("https://forum.example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/categories", nil)
+	req.Header.Set("Origin", "https://forum.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://forum.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	exposed := strings.ToLower(rec.Header().Get("Access-Control-Expose-Headers"))
+	for _, header := range append([]string{middleware.RequestIDHeader}, middleware.RateLimitHeaders...) {
+		if !strings.Contains(exposed, strings.ToLower(header)) {
+			t.Errorf("Access-Control-Expose-Headers = %q, want it to include %s", exposed, header)
+		}
+	}
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	limits := middleware.NewRateLimits(config.RateLimit{Store: "none"}, nil)
+
+	tests := []struct {
+		name       string
+		sunset     time.Time
+		path       string
+		wantStatus int
+		deprecated bool
+	}{
+		{"versioned route", time.Now().Add(-time.Hour), "/api/v1/categories", http.StatusOK, false},
+		{"before the sunset", time.Now().Add(time.Hour), "/categories", http.StatusOK, true},
+		// The sunset can pass while the server is running, so it is checked per request
+		{"after the sunset", time.Now().Add(-time.Hour), "/categories", http.StatusGone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := router.Setup(memory.New().Stores(), config.CORS{}, config.API{LegacySunset: tt.sunset}, config.Metrics{}, limits)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Sunset"); (got != "") != tt.deprecated {
+				t.Errorf("Sunset = %q, want it set only on the legacy routes", got)
+			}
+			if tt.deprecated && rec.Header().Get("Link") != `</api/v1/categories>; rel="successor-version"` {
+				t.Errorf("Link = %q, want the /api/v1 route as the successor", rec.Header().Get("Link"))
+			}
+
+			if tt.wantStatus == http.StatusGone {
+				var response api.Response
+				if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response.ErrorCode != api.ErrorCodeGone {
+					t.Errorf("error code = %d, want %d", response.ErrorCode, api.ErrorCodeGone)
+				}
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	limits := middleware.NewRateLimits(config.RateLimit{Store: "none"}, nil)
+	apiConfig := config.API{LegacySunset: time.Now().Add(365 * 24 * time.Hour)}
+
+	tests := []struct {
+		name          string
+		metrics       config.Metrics
+		authorization string
+		wantStatus    int
+	}{
+		{"not configured", config.Metrics{}, "", http.StatusNotFound},
+		{"served on their own address", config.Metrics{Addr: ":9090", Token: "scrape"}, "Bearer scrape", http.StatusNotFound},
+		{"without the token", config.Metrics{Token: "scrape"}, "", http.StatusUnauthorized},
+		{"with another token", config.Metrics{Token: "scrape"}, "Bearer guess", http.StatusUnauthorized},
+		{"with the token", config.Metrics{Token: "scrape"}, "Bearer scrape", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := router.Setup(memory.New().Stores(), config.CORS{}, apiConfig, tt.metrics, limits)
+			// Handle a request first so the HTTP metrics have a series to report
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/categories", nil))
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(rec.Body.String(), `http_requests_total{method="GET",route="/api/v1/categories",status="200"}`) {
+				t.Errorf("metrics do not count the request to /api/v1/categories:\n%s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -1,205 +1,183 @@
 package routes
 
 import (
+	"net/http"
 	"github.com/go-chi/chi/v5"
 	"github.com/blobfish465/common-circle-web-forum/internal/handlers/users"
 	"github.com/blobfish465/common-circle-web-forum/internal/handlers/threads"
 	"github.com/blobfish465/common-circle-web-forum/internal/handlers/comments"
 	"github.com/blobfish465/common-circle-web-forum/internal/handlers/categories"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/votes"
+	"github.com/blobfish465/common-circle-web-forum/internal/handlers/badges"
 	"github.com/blobfish465/common-circle-web-forum/internal/auth"
-	"net/http"
-	"fmt"
-	"encoding/json"
+	"github.com/blobfish465/common-circle-web-forum/internal/middleware"
+	"github.com/blobfish465/common-circle-web-forum/internal/openapi"
+	"github.com/blobfish465/common-circle-web-forum/internal/api"
 )
 
-// GetPublicRoutes returns a function to set up public routes
-func GetPublicRoutes() func(r chi.Router) {
+// Resource registers the routes of one resource, rate limited by limits
+type Resource func(r chi.Router, limits middleware.RateLimits)
+
+// Version is the resources of one version of the API. A new version lists the resources
+// of the previous one, replacing only those whose routes have changed.
+type Version []Resource
+
+// V1 is the API served under /api/v1
+var V1 = Version{
+	AuthV1,
+	UsersV1,
+	ThreadsV1,
+	CommentsV1,
+	VotesV1,
+	CategoriesV1,
+	BadgesV1,
+	DocsV1,
+}
+
+// Routes returns a function that sets up every route of the version, rate limited by limits
+func (v Version) Routes(limits middleware.RateLimits) func(r chi.Router) {
 	return func(r chi.Router) {
-		r.Post("/login", auth.Login) 
-
-		r.Get("/users/{id}", func(w http.ResponseWriter, req *http.Request) {
-			response, err := users.HandleGetUserByID(w, req)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error: %s", err.Error()), http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-
-		r.Post("/users", func(w http.ResponseWriter, req *http.Request) {
-			response, err := users.HandleCreateUsers(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-
-		r.Get("/threads", func(w http.ResponseWriter, req *http.Request) {
-			response, err := threads.HandleListThreads(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-
-		r.Get("/threads/{id}", func(w http.ResponseWriter, req *http.Request) {
-			response, err := threads.HandleGetThreadByID(w, req)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error: %s", err.Error()), http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-
-		r.Get("/threads/{thread_id}/comments", func(w http.ResponseWriter, req *http.Request) {
-			response, err := comments.HandleListCommentsByThread(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-
-		r.Post("/threads", func(w http.ResponseWriter, req *http.Request) {
-			response, err := threads.HandleCreateThreads(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
+		for _, resource := range v {
+			resource(r, limits)
+		}
+	}
+}
 
-		// Get all the categories
-		r.Get("/categories", func(w http.ResponseWriter, req *http.Request) {
-			response, err := categories.HandleListCategories(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
+// public sets up routes that anyone may call, rate limited by limit
+func public(r chi.Router, limit func(http.Handler) http.Handler, routes func(r chi.Router)) {
+	r.Group(func(r chi.Router) {
+		r.Use(limit)
+		routes(r)
+	})
+}
 
-		// Get all the threads of the specified category
-		r.Get("/categories/{id}/threads", func(w http.ResponseWriter, req *http.Request) {
-			response, err := threads.HandleListThreadsByCategory(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-		
-		// Get category details of a specific cateogry
-		r.Get("/categories/{id}", func(w http.ResponseWriter, req *http.Request) {
-			response, err := categories.HandleGetCategoryByID(w, req)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		})
-	}
+// private sets up routes that require authentication, rate limited per user by limit
+func private(r chi.Router, limit func(http.Handler) http.Handler, routes func(r chi.Router)) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware) // Apply JWT authentication middleware
+		r.Use(limit)
+		routes(r)
+	})
 }
 
-// GetPrivateRoutes sets up private routes requiring authentication
-func GetPrivateRoutes(r chi.Router) {
+// AuthV1 sets up logging in, which is limited the most as it is the target of credential stuffing
+func AuthV1(r chi.Router, limits middleware.RateLimits) {
+	public(r, limits.Auth, func(r chi.Router) {
+		r.Post("/login", auth.Login)
 
-	r.Get("/users/{userId}/threads", func(w http.ResponseWriter, req *http.Request) {
-		response, err := threads.HandleListThreadsByUser(w, req)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error: %s", err.Error()), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		// Social login through the configured OpenID Connect providers
+		r.Get("/auth/{provider}/login", auth.HandleOIDCLogin)
+		r.Get("/auth/{provider}/callback", auth.HandleOIDCCallback)
 	})
 
-	r.Delete("/users/{id}", func(w http.ResponseWriter, req *http.Request) {
-		users.HandleDeleteUser(w, req)
+	public(r, limits.Read, func(r chi.Router) {
+		r.Get("/auth/providers", auth.HandleListOIDCProviders)
 	})
+}
 
-	r.Put("/threads/{id}", func(w http.ResponseWriter, req *http.Request) {
-		response, err := threads.HandleUpdateThreads(w, req)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+// UsersV1 sets up signing up, profiles and the authenticated user's account
+func UsersV1(r chi.Router, limits middleware.RateLimits) {
+	// Signing up is limited like logging in to slow down spam accounts
+	public(r, limits.Auth, func(r chi.Router) {
+		r.Post("/users", api.Created(users.HandleCreateUsers))
+
+		// Confirm a change of email address with the token from the verification link
+		r.Post("/verify-email", api.Handle(users.HandleVerifyEmail))
 	})
 
-	r.Delete("/threads/{id}", func(w http.ResponseWriter, req *http.Request) {
-		response, err := threads.HandleDeleteThreads(w, req)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	public(r, limits.Read, func(r chi.Router) {
+		// Public profile, which includes the email address for its owner and admins
+		r.With(middleware.OptionalAuthMiddleware).Get("/users/{id}", api.Handle(users.HandleGetUserByID))
 	})
 
-	// Get comments made by a specific user
-	r.Get("/users/{userId}/comments", func(w http.ResponseWriter, req *http.Request) {
-		response, err := comments.HandleListCommentsByUser(w, req)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error: %s", err.Error()), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	private(r, limits.Read, func(r chi.Router) {
+		// Profile of the authenticated user
+		r.Get("/me", api.Handle(users.HandleGetMe))
 	})
 
+	private(r, limits.Write, func(r chi.Router) {
+		r.Patch("/me", api.Handle(users.HandleUpdateMe))
+		r.Put("/me/password", api.Handle(users.HandleChangePassword))
 
-	r.Post("/comments", func(w http.ResponseWriter, req *http.Request) {
-		response, err := comments.HandleCreateComments(w, req)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		r.Delete("/users/{id}", api.Handle(users.HandleDeleteUser))
 	})
+}
 
-	r.Put("/comments/{id}", func(w http.ResponseWriter, req *http.Request) {
-		response, err := comments.HandleUpdateComments(w, req)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+// ThreadsV1 sets up reading and writing threads
+func ThreadsV1(r chi.Router, limits middleware.RateLimits) {
+	public(r, limits.Read, func(r chi.Router) {
+		r.Get("/threads", api.Handle(threads.HandleListThreads))
+		r.Get("/threads/{id}", api.Handle(threads.HandleGetThreadByID))
+
+		// Get all the threads of the specified category
+		r.Get("/categories/{id}/threads", api.Handle(threads.HandleListThreadsByCategory))
 	})
 
-	r.Delete("/comments/{id}", func(w http.ResponseWriter, req *http.Request) {
-		response, err := comments.HandleDeleteComments(w, req)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	private(r, limits.Read, func(r chi.Router) {
+		r.Get("/users/{userId}/threads", api.Handle(threads.HandleListThreadsByUser))
+	})
+
+	// Threads are written by the authenticated user
+	private(r, limits.Write, func(r chi.Router) {
+		r.Post("/threads", api.Created(threads.HandleCreateThreads))
+		r.Put("/threads/{id}", api.Handle(threads.HandleUpdateThreads))
+		r.Delete("/threads/{id}", api.Handle(threads.HandleDeleteThreads))
+
+		// Mark a comment as the accepted answer of a thread
+		r.Put("/threads/{id}/accepted-comment", api.Handle(threads.HandleAcceptAnswer))
+	})
+}
+
+// CommentsV1 sets up reading and writing comments
+func CommentsV1(r chi.Router, limits middleware.RateLimits) {
+	public(r, limits.Read, func(r chi.Router) {
+		r.Get("/threads/{thread_id}/comments", api.Handle(comments.HandleListCommentsByThread))
 	})
+
+	private(r, limits.Read, func(r chi.Router) {
+		// Get comments made by a specific user
+		r.Get("/users/{userId}/comments", api.Handle(comments.HandleListCommentsByUser))
+	})
+
+	// Comments are written by the authenticated user
+	private(r, limits.Write, func(r chi.Router) {
+		r.Post("/comments", api.Created(comments.HandleCreateComments))
+		r.Put("/comments/{id}", api.Handle(comments.HandleUpdateComments))
+		r.Delete("/comments/{id}", api.Handle(comments.HandleDeleteComments))
+	})
+}
+
+// VotesV1 sets up upvotes, which count towards the author's reputation
+func VotesV1(r chi.Router, limits middleware.RateLimits) {
+	private(r, limits.Write, func(r chi.Router) {
+		r.Post("/threads/{id}/upvote", api.Handle(votes.HandleUpvoteThread))
+		r.Delete("/threads/{id}/upvote", api.Handle(votes.HandleRemoveThreadUpvote))
+		r.Post("/comments/{id}/upvote", api.Handle(votes.HandleUpvoteComment))
+		r.Delete("/comments/{id}/upvote", api.Handle(votes.HandleRemoveCommentUpvote))
+	})
+}
+
+// CategoriesV1 sets up reading categories
+func CategoriesV1(r chi.Router, limits middleware.RateLimits) {
+	public(r, limits.Read, func(r chi.Router) {
+		// Get all the categories
+		r.Get("/categories", api.Handle(categories.HandleListCategories))
+
+		// Get category details of a specific cateogry
+		r.Get("/categories/{id}", api.Handle(categories.HandleGetCategoryByID))
+	})
+}
+
+// BadgesV1 sets up the badge catalog and the badges awarded to a user
+func BadgesV1(r chi.Router, limits middleware.RateLimits) {
+	public(r, limits.Read, func(r chi.Router) {
+		r.Get("/badges", api.Handle(badges.HandleListBadges))
+		r.Get("/users/{id}/badges", api.Handle(badges.HandleListUserBadges))
+	})
+}
+
+// DocsV1 sets up the OpenAPI document describing the version, and a page to browse it
+func DocsV1(r chi.Router, limits middleware.RateLimits) {
+	r.Get("/openapi.json", openapi.HandleSpec)
+	r.Get("/docs", openapi.HandleDocs)
 }
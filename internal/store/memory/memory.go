@@ -0,0 +1,869 @@
+// Package memory implements the store interfaces in memory. It mirrors the behaviour of
+// the Postgres schema, including foreign keys, cascading deletes and unique usernames and
+// emails, so handlers can be exercised without a database. Transactions hold the
+// database's lock until they finish, so they run one at a time, and are undone by
+// restoring a copy of the data taken when they started.
+package memory
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+// excerptLength is how many characters of a thread or comment are shown in recent activity
+const excerptLength = 200
+
+// DB holds the data shared by the stores returned from Stores
+type DB struct {
+	mu sync.Mutex
+	*tables
+	// inTx is set on the database given to a transaction, whose caller already holds mu
+	inTx bool
+
+	// Now returns the time given to new rows. It can be replaced to make timestamps predictable.
+	Now func() time.Time
+}
+
+// tables is the data of a database, shared with the transactions started on it
+type tables struct {
+	users         map[int]models.User
+	threads       map[int]models.Thread
+	comments      map[int]models.Comment
+	categories    map[int]models.Category
+	votes         map[vote]time.Time
+	reputation    map[int]int
+	badges        map[userBadge]time.Time
+	verifications map[string]models.EmailVerification
+	identities    map[identity]models.LinkedIdentity
+	lastID        map[string]int
+}
+
+// vote is the key of an upvote, as a user can give each thread or comment one
+type vote struct {
+	userID   int
+	target   string
+	targetID int
+}
+
+// identity is the key of a linked identity, as each provider account links to one user
+type identity struct {
+	provider string
+	subject  string
+}
+
+// userBadge is the key of a badge award
+type userBadge struct {
+	userID int
+	code   string
+}
+
+// New returns an empty database with the same predefined categories as Postgres
+func New() *DB {
+	db := &DB{
+		tables: &tables{
+			users:         make(map[int]models.User),
+			threads:       make(map[int]models.Thread),
+			comments:      make(map[int]models.Comment),
+			categories:    make(map[int]models.Category),
+			votes:         make(map[vote]time.Time),
+			reputation:    make(map[int]int),
+			badges:        make(map[userBadge]time.Time),
+			verifications: make(map[string]models.EmailVerification),
+			identities:    make(map[identity]models.LinkedIdentity),
+			lastID:        make(map[string]int),
+		},
+		Now: time.Now,
+	}
+	for _, name := range database.PredefinedCategories {
+		id := db.newID("categories")
+		db.categories[id] = models.Category{ID: id, Name: name}
+	}
+	return db
+}
+
+// Stores returns stores that read and write db
+func (db *DB) Stores() *store.Stores {
+	return &store.Stores{
+		Threads:       threadStore{db},
+		Comments:      commentStore{db},
+		Users:         userStore{db},
+		Categories:    categoryStore{db},
+		Votes:         voteStore{db},
+		Reputation:    reputationStore{db},
+		Badges:        badgeStore{db},
+		Verifications: verificationStore{db},
+		Identities:    identityStore{db},
+		Transactor:    db,
+	}
+}
+
+// WithTx runs fn holding the lock of db, with stores that share its data but do not take
+// the lock again. If fn returns an error, the data is restored to what it was before.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *store.Stores) error) error {
+	if db.inTx {
+		return fn(db.Stores())
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := db.tables.clone()
+	tx := &DB{tables: db.tables, inTx: true, Now: db.Now}
+	if err := fn(tx.Stores()); err != nil {
+		*db.tables = *saved
+		return err
+	}
+	return nil
+}
+
+// clone copies the tables. Rows are stored by value and replaced rather than changed in
+// place, so a shallow copy of each map is enough.
+func (t *tables) clone() *tables {
+	return &tables{
+		users:         maps.Clone(t.users),
+		threads:       maps.Clone(t.threads),
+		comments:      maps.Clone(t.comments),
+		categories:    maps.Clone(t.categories),
+		votes:         maps.Clone(t.votes),
+		reputation:    maps.Clone(t.reputation),
+		badges:        maps.Clone(t.badges),
+		verifications: maps.Clone(t.verifications),
+		identities:    maps.Clone(t.identities),
+		lastID:        maps.Clone(t.lastID),
+	}
+}
+
+// lock takes the lock of db for a single operation and returns the function releasing it.
+// Inside a transaction the lock is already held, so both do nothing.
+func (db *DB) lock() func() {
+	if db.inTx {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// newID returns the next ID of a table, like a SERIAL column. Callers must hold db.mu.
+func (db *DB) newID(table string) int {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+func (db *DB) now() time.Time {
+	return db.Now().UTC()
+}
+
+// withAuthor fills in the author fields that Postgres gets by joining users. Callers must hold db.mu.
+func (db *DB) withAuthor(thread models.Thread) models.Thread {
+	thread.AuthorUsername = db.users[thread.UserID].Username
+	thread.AuthorReputation = db.reputation[thread.UserID]
+	if thread.AcceptedCommentID != nil {
+		commentID := *thread.AcceptedCommentID
+		thread.AcceptedCommentID = &commentID
+	}
+	return thread
+}
+
+// deleteThread removes a thread with its comments and votes. Callers must hold db.mu.
+func (db *DB) deleteThread(id int) {
+	delete(db.threads, id)
+	db.deleteVotes(func(v vote) bool { return v.target == models.VoteTargetThread && v.targetID == id })
+	for commentID, comment := range db.comments {
+		if comment.ThreadID == id {
+			db.deleteComment(commentID)
+		}
+	}
+}
+
+// deleteComment removes a comment with its votes and clears it as an accepted answer.
+// Callers must hold db.mu.
+func (db *DB) deleteComment(id int) {
+	delete(db.comments, id)
+	db.deleteVotes(func(v vote) bool { return v.target == models.VoteTargetComment && v.targetID == id })
+	for threadID, thread := range db.threads {
+		if thread.AcceptedCommentID != nil && *thread.AcceptedCommentID == id {
+			thread.AcceptedCommentID = nil
+			db.threads[threadID] = thread
+		}
+	}
+}
+
+// deleteVotes removes the votes matching match. Callers must hold db.mu.
+func (db *DB) deleteVotes(match func(vote) bool) {
+	for v := range db.votes {
+		if match(v) {
+			delete(db.votes, v)
+		}
+	}
+}
+
+// authorOf returns the author of a vote's target, or 0 if it does not exist. Callers must hold db.mu.
+func (db *DB) authorOf(target string, targetID int) int {
+	if target == models.VoteTargetThread {
+		return db.threads[targetID].UserID
+	}
+	return db.comments[targetID].UserID
+}
+
+// revokeAwardedBy takes back the points a user gave others through upvotes and accepted
+// answers, like reputation.RevokeAwardedBy. Callers must hold db.mu.
+func (db *DB) revokeAwardedBy(userID int) {
+	for v := range db.votes {
+		if v.userID != userID {
+			continue
+		}
+		if recipient := db.authorOf(v.target, v.targetID); recipient != 0 && recipient != userID {
+			db.reputation[recipient] -= reputation.UpvotePoints
+		}
+	}
+	for _, thread := range db.threads {
+		if thread.UserID != userID || thread.AcceptedCommentID == nil {
+			continue
+		}
+		if recipient := db.comments[*thread.AcceptedCommentID].UserID; recipient != userID {
+			db.reputation[recipient] -= reputation.AcceptedAnswerPoints
+		}
+	}
+}
+
+type threadStore struct {
+	db *DB
+}
+
+func (s threadStore) list(keep func(models.Thread) bool) []models.Thread {
+	defer s.db.lock()()
+
+	var threads []models.Thread
+	for _, thread := range s.db.threads {
+		if keep(thread) {
+			threads = append(threads, s.db.withAuthor(thread))
+		}
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].ID < threads[j].ID })
+	return threads
+}
+
+func (s threadStore) List(ctx context.Context) ([]models.Thread, error) {
+	return s.list(func(models.Thread) bool { return true }), nil
+}
+
+func (s threadStore) GetByID(ctx context.Context, id int) (*models.Thread, error) {
+	defer s.db.lock()()
+
+	thread, ok := s.db.threads[id]
+	if !ok {
+		return nil, apperrors.NotFound("thread with ID %d not found", id)
+	}
+	thread = s.db.withAuthor(thread)
+	return &thread, nil
+}
+
+func (s threadStore) ListByUserID(ctx context.Context, userID int) ([]models.Thread, error) {
+	return s.list(func(thread models.Thread) bool { return thread.UserID == userID }), nil
+}
+
+func (s threadStore) ListByCategoryID(ctx context.Context, categoryID int) ([]models.Thread, error) {
+	return s.list(func(thread models.Thread) bool { return thread.CategoryID == categoryID }), nil
+}
+
+func (s threadStore) Create(ctx context.Context, thread *models.Thread) (int, error) {
+	defer s.db.lock()()
+
+	_, userExists := s.db.users[thread.UserID]
+	_, categoryExists := s.db.categories[thread.CategoryID]
+	if !userExists || !categoryExists {
+		return 0, apperrors.Validation("category %d or user %d does not exist", thread.CategoryID, thread.UserID)
+	}
+
+	thread.ID = s.db.newID("threads")
+	thread.CreatedAt = s.db.now()
+	thread.UpdatedAt = nil
+	thread.AcceptedCommentID = nil
+	s.db.threads[thread.ID] = *thread
+	return thread.ID, nil
+}
+
+func (s threadStore) Update(ctx context.Context, thread *models.Thread) error {
+	defer s.db.lock()()
+
+	if _, ok := s.db.categories[thread.CategoryID]; !ok {
+		return apperrors.Validation("category %d does not exist", thread.CategoryID)
+	}
+	stored, ok := s.db.threads[thread.ID]
+	if !ok {
+		return nil
+	}
+	updatedAt := s.db.now()
+	stored.Title = thread.Title
+	stored.Content = thread.Content
+	stored.CategoryID = thread.CategoryID
+	stored.UpdatedAt = &updatedAt
+	s.db.threads[thread.ID] = stored
+	return nil
+}
+
+func (s threadStore) Delete(ctx context.Context, id int) error {
+	defer s.db.lock()()
+
+	s.db.deleteThread(id)
+	return nil
+}
+
+func (s threadStore) SetAcceptedComment(ctx context.Context, threadID int, commentID *int) error {
+	defer s.db.lock()()
+
+	thread, ok := s.db.threads[threadID]
+	if !ok {
+		return nil
+	}
+	if commentID == nil {
+		thread.AcceptedCommentID = nil
+	} else {
+		if _, ok := s.db.comments[*commentID]; !ok {
+			return apperrors.Validation("comment %d does not exist", *commentID)
+		}
+		accepted := *commentID
+		thread.AcceptedCommentID = &accepted
+	}
+	s.db.threads[threadID] = thread
+	return nil
+}
+
+type commentStore struct {
+	db *DB
+}
+
+func (s commentStore) list(keep func(models.Comment) bool) []models.Comment {
+	defer s.db.lock()()
+
+	var comments []models.Comment
+	for _, comment := range s.db.comments {
+		if keep(comment) {
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	return comments
+}
+
+func (s commentStore) List(ctx context.Context) ([]models.Comment, error) {
+	return s.list(func(models.Comment) bool { return true }), nil
+}
+
+func (s commentStore) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	defer s.db.lock()()
+
+	comment, ok := s.db.comments[id]
+	if !ok {
+		return nil, apperrors.NotFound("comment with ID %d not found", id)
+	}
+	return &comment, nil
+}
+
+func (s commentStore) ListByThreadID(ctx context.Context, threadID int) ([]models.Comment, error) {
+	return s.list(func(comment models.Comment) bool { return comment.ThreadID == threadID }), nil
+}
+
+func (s commentStore) ListByUserID(ctx context.Context, userID int) ([]models.Comment, error) {
+	comments := s.list(func(comment models.Comment) bool { return comment.UserID == userID })
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return comments, nil
+}
+
+func (s commentStore) Create(ctx context.Context, comment *models.Comment) (int, error) {
+	defer s.db.lock()()
+
+	_, userExists := s.db.users[comment.UserID]
+	_, threadExists := s.db.threads[comment.ThreadID]
+	if !userExists || !threadExists {
+		return 0, apperrors.Validation("thread %d or user %d does not exist", comment.ThreadID, comment.UserID)
+	}
+
+	comment.ID = s.db.newID("comments")
+	comment.CreatedAt = s.db.now()
+	comment.UpdatedAt = nil
+	s.db.comments[comment.ID] = *comment
+	return comment.ID, nil
+}
+
+func (s commentStore) Update(ctx context.Context, comment *models.Comment) error {
+	defer s.db.lock()()
+
+	stored, ok := s.db.comments[comment.ID]
+	if !ok {
+		return nil
+	}
+	updatedAt := s.db.now()
+	stored.Content = comment.Content
+	stored.UpdatedAt = &updatedAt
+	s.db.comments[comment.ID] = stored
+	return nil
+}
+
+func (s commentStore) Delete(ctx context.Context, id int) error {
+	defer s.db.lock()()
+
+	s.db.deleteComment(id)
+	return nil
+}
+
+type userStore struct {
+	db *DB
+}
+
+// find returns the first user matching keep. Callers must hold db.mu.
+func (s userStore) find(keep func(models.User) bool) (models.User, bool) {
+	for _, user := range s.db.users {
+		if keep(user) {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (s userStore) List(ctx context.Context) ([]models.User, error) {
+	defer s.db.lock()()
+
+	var users []models.User
+	for _, user := range s.db.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (s userStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	defer s.db.lock()()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil, apperrors.NotFound("user with ID %d not found", id)
+	}
+	return &user, nil
+}
+
+func (s userStore) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	defer s.db.lock()()
+
+	user, ok := s.find(func(user models.User) bool { return user.Username == username })
+	if !ok {
+		return nil, apperrors.NotFound("user with username %s not found", username)
+	}
+	return &user, nil
+}
+
+func (s userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer s.db.lock()()
+
+	user, ok := s.find(func(user models.User) bool { return strings.EqualFold(user.Email, email) })
+	if !ok {
+		return nil, apperrors.NotFound("user with email %s not found", email)
+	}
+	return &user, nil
+}
+
+func (s userStore) Create(ctx context.Context, user *models.User) error {
+	defer s.db.lock()()
+
+	_, taken := s.find(func(existing models.User) bool {
+		return existing.Username == user.Username || existing.Email == user.Email
+	})
+	if taken {
+		return apperrors.Conflict("username or email is already taken")
+	}
+
+	user.ID = s.db.newID("users")
+	user.CreatedAt = s.db.now()
+	s.db.users[user.ID] = *user
+	return nil
+}
+
+func (s userStore) Delete(ctx context.Context, id int) error {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[id]; !ok {
+		return apperrors.NotFound("user with ID %d not found", id)
+	}
+	s.db.revokeAwardedBy(id)
+	delete(s.db.users, id)
+	delete(s.db.reputation, id)
+	s.db.deleteVotes(func(v vote) bool { return v.userID == id })
+	for key := range s.db.badges {
+		if key.userID == id {
+			delete(s.db.badges, key)
+		}
+	}
+	for tokenHash, verification := range s.db.verifications {
+		if verification.UserID == id {
+			delete(s.db.verifications, tokenHash)
+		}
+	}
+	for key, linked := range s.db.identities {
+		if linked.UserID == id {
+			delete(s.db.identities, key)
+		}
+	}
+	for threadID, thread := range s.db.threads {
+		if thread.UserID == id {
+			s.db.deleteThread(threadID)
+		}
+	}
+	for commentID, comment := range s.db.comments {
+		if comment.UserID == id {
+			s.db.deleteComment(commentID)
+		}
+	}
+	return nil
+}
+
+func (s userStore) UpdateProfile(ctx context.Context, user *models.User) error {
+	defer s.db.lock()()
+
+	stored, ok := s.db.users[user.ID]
+	if !ok {
+		return nil
+	}
+	_, taken := s.find(func(existing models.User) bool {
+		return existing.ID != user.ID && existing.Username == user.Username
+	})
+	if taken {
+		return apperrors.Conflict("username %s is already taken", user.Username)
+	}
+	stored.Username = user.Username
+	stored.DisplayName = user.DisplayName
+	stored.Bio = user.Bio
+	stored.AvatarURL = user.AvatarURL
+	s.db.users[user.ID] = stored
+	return nil
+}
+
+func (s userStore) UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	defer s.db.lock()()
+
+	if stored, ok := s.db.users[userID]; ok {
+		stored.PasswordHash = passwordHash
+		s.db.users[userID] = stored
+	}
+	return nil
+}
+
+func (s userStore) UpdateEmail(ctx context.Context, userID int, email string) error {
+	defer s.db.lock()()
+
+	stored, ok := s.db.users[userID]
+	if !ok {
+		return nil
+	}
+	_, taken := s.find(func(existing models.User) bool {
+		return existing.ID != userID && existing.Email == email
+	})
+	if taken {
+		return apperrors.Conflict("email %s is already in use", email)
+	}
+	stored.Email = email
+	stored.EmailVerified = true
+	s.db.users[userID] = stored
+	return nil
+}
+
+func (s userStore) GetProfile(ctx context.Context, id int) (*models.UserProfile, error) {
+	defer s.db.lock()()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil, apperrors.NotFound("user with ID %d not found", id)
+	}
+	profile := models.UserProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		JoinedAt:    user.CreatedAt,
+		Reputation:  s.db.reputation[id],
+	}
+	for _, thread := range s.db.threads {
+		if thread.UserID == id {
+			profile.ThreadCount++
+		}
+	}
+	for _, comment := range s.db.comments {
+		if comment.UserID == id {
+			profile.CommentCount++
+		}
+	}
+	return &profile, nil
+}
+
+func (s userStore) ListRecentActivity(ctx context.Context, userID int, limit int) ([]models.Activity, error) {
+	defer s.db.lock()()
+
+	activity := []models.Activity{}
+	for _, thread := range s.db.threads {
+		if thread.UserID == userID {
+			activity = append(activity, models.Activity{
+				Type:        "thread",
+				ID:          thread.ID,
+				ThreadID:    thread.ID,
+				ThreadTitle: thread.Title,
+				Excerpt:     excerpt(thread.Content),
+				CreatedAt:   thread.CreatedAt,
+			})
+		}
+	}
+	for _, comment := range s.db.comments {
+		if comment.UserID == userID {
+			activity = append(activity, models.Activity{
+				Type:        "comment",
+				ID:          comment.ID,
+				ThreadID:    comment.ThreadID,
+				ThreadTitle: s.db.threads[comment.ThreadID].Title,
+				Excerpt:     excerpt(comment.Content),
+				CreatedAt:   comment.CreatedAt,
+			})
+		}
+	}
+
+	sort.Slice(activity, func(i, j int) bool { return activity[i].CreatedAt.After(activity[j].CreatedAt) })
+	if len(activity) > limit {
+		activity = activity[:limit]
+	}
+	return activity, nil
+}
+
+func (s userStore) ListPostsSince(ctx context.Context, userID int, since time.Time, limit int) ([]models.Post, error) {
+	defer s.db.lock()()
+
+	posts := []models.Post{}
+	for _, thread := range s.db.threads {
+		if thread.UserID == userID && thread.CreatedAt.After(since) {
+			posts = append(posts, models.Post{Type: "thread", ID: thread.ID, Content: thread.Content, CreatedAt: thread.CreatedAt})
+		}
+	}
+	for _, comment := range s.db.comments {
+		if comment.UserID == userID && comment.CreatedAt.After(since) {
+			posts = append(posts, models.Post{Type: "comment", ID: comment.ID, Content: comment.Content, CreatedAt: comment.CreatedAt})
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.After(posts[j].CreatedAt) })
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+// excerpt returns the start of some content, like LEFT(content, 200) in Postgres
+func excerpt(content string) string {
+	runes := []rune(content)
+	if len(runes) > excerptLength {
+		return string(runes[:excerptLength])
+	}
+	return content
+}
+
+type categoryStore struct {
+	db *DB
+}
+
+func (s categoryStore) List(ctx context.Context) ([]models.Category, error) {
+	defer s.db.lock()()
+
+	var categories []models.Category
+	for _, category := range s.db.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+	return categories, nil
+}
+
+func (s categoryStore) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	defer s.db.lock()()
+
+	category, ok := s.db.categories[id]
+	if !ok {
+		return nil, apperrors.NotFound("category with ID %d not found", id)
+	}
+	return &category, nil
+}
+
+type voteStore struct {
+	db *DB
+}
+
+func (s voteStore) Add(ctx context.Context, userID int, target string, targetID int) (bool, error) {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[userID]; !ok || s.db.authorOf(target, targetID) == 0 {
+		return false, apperrors.Validation("%s %d or user %d does not exist", target, targetID, userID)
+	}
+	key := vote{userID: userID, target: target, targetID: targetID}
+	if _, ok := s.db.votes[key]; ok {
+		return false, nil
+	}
+	s.db.votes[key] = s.db.now()
+	return true, nil
+}
+
+func (s voteStore) Remove(ctx context.Context, userID int, target string, targetID int) (bool, error) {
+	defer s.db.lock()()
+
+	key := vote{userID: userID, target: target, targetID: targetID}
+	if _, ok := s.db.votes[key]; !ok {
+		return false, nil
+	}
+	delete(s.db.votes, key)
+	return true, nil
+}
+
+func (s voteStore) Count(ctx context.Context, target string, targetID int) (int, error) {
+	defer s.db.lock()()
+
+	count := 0
+	for v := range s.db.votes {
+		if v.target == target && v.targetID == targetID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type reputationStore struct {
+	db *DB
+}
+
+func (s reputationStore) Adjust(ctx context.Context, userID int, points int) error {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return apperrors.Validation("user %d does not exist", userID)
+	}
+	s.db.reputation[userID] += points
+	return nil
+}
+
+type badgeStore struct {
+	db *DB
+}
+
+func (s badgeStore) Award(ctx context.Context, userID int, code string) (bool, error) {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return false, apperrors.Validation("user %d does not exist", userID)
+	}
+	key := userBadge{userID: userID, code: code}
+	if _, ok := s.db.badges[key]; ok {
+		return false, nil
+	}
+	s.db.badges[key] = s.db.now()
+	return true, nil
+}
+
+func (s badgeStore) ListAwarded(ctx context.Context, userID int) (map[string]time.Time, error) {
+	defer s.db.lock()()
+
+	awarded := make(map[string]time.Time)
+	for key, awardedAt := range s.db.badges {
+		if key.userID == userID {
+			awarded[key.code] = awardedAt
+		}
+	}
+	return awarded, nil
+}
+
+func (s badgeStore) GetActivityStats(ctx context.Context, userID int) (*models.ActivityStats, error) {
+	defer s.db.lock()()
+
+	user, ok := s.db.users[userID]
+	if !ok {
+		return nil, apperrors.NotFound("user with ID %d not found", userID)
+	}
+	stats := models.ActivityStats{
+		UserID:     userID,
+		MemberDays: int(s.db.now().Sub(user.CreatedAt) / (24 * time.Hour)),
+	}
+	for _, thread := range s.db.threads {
+		if thread.UserID == userID {
+			stats.ThreadCount++
+		}
+	}
+	for _, comment := range s.db.comments {
+		if comment.UserID == userID {
+			stats.CommentCount++
+		}
+	}
+	return &stats, nil
+}
+
+type verificationStore struct {
+	db *DB
+}
+
+func (s verificationStore) Create(ctx context.Context, userID int, email string, tokenHash string, expiresAt time.Time) error {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return apperrors.Validation("user %d does not exist", userID)
+	}
+	for hash, verification := range s.db.verifications {
+		if verification.UserID == userID {
+			delete(s.db.verifications, hash)
+		}
+	}
+	s.db.verifications[tokenHash] = models.EmailVerification{UserID: userID, Email: email, ExpiresAt: expiresAt.UTC()}
+	return nil
+}
+
+func (s verificationStore) Consume(ctx context.Context, tokenHash string) (*models.EmailVerification, error) {
+	defer s.db.lock()()
+
+	verification, ok := s.db.verifications[tokenHash]
+	if !ok {
+		return nil, apperrors.NotFound("email verification not found")
+	}
+	delete(s.db.verifications, tokenHash)
+	return &verification, nil
+}
+
+type identityStore struct {
+	db *DB
+}
+
+func (s identityStore) GetByProviderSubject(ctx context.Context, provider string, subject string) (*models.LinkedIdentity, error) {
+	defer s.db.lock()()
+
+	linked, ok := s.db.identities[identity{provider, subject}]
+	if !ok {
+		return nil, apperrors.NotFound("identity %s/%s not found", provider, subject)
+	}
+	return &linked, nil
+}
+
+func (s identityStore) Create(ctx context.Context, linked *models.LinkedIdentity) (int, error) {
+	defer s.db.lock()()
+
+	if _, ok := s.db.users[linked.UserID]; !ok {
+		return 0, apperrors.Validation("user %d does not exist", linked.UserID)
+	}
+	key := identity{linked.Provider, linked.Subject}
+	if _, ok := s.db.identities[key]; ok {
+		return 0, apperrors.Conflict("this %s account is already linked", linked.Provider)
+	}
+
+	linked.ID = s.db.newID("linked_identities")
+	linked.CreatedAt = s.db.now()
+	s.db.identities[key] = *linked
+	return linked.ID, nil
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+func TestWithTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	stores := New().Stores()
+
+	user := models.User{Username: "alice", Email: "alice@example.com"}
+	if err := stores.Users.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err := stores.WithTx(ctx, func(tx *store.Stores) error {
+		thread := models.Thread{UserID: user.ID, CategoryID: 1, Title: "Hello", Content: "World"}
+		if _, err := tx.Threads.Create(ctx, &thread); err != nil {
+			return err
+		}
+		// A nested transaction joins the outer one rather than waiting for its lock
+		return tx.WithTx(ctx, func(tx *store.Stores) error {
+			if err := tx.Reputation.Adjust(ctx, user.ID, 10); err != nil {
+				return err
+			}
+			return failure
+		})
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithTx returned %v, want %v", err, failure)
+	}
+
+	threads, err := stores.Threads.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := stores.Users.GetProfile(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 0 || profile.Reputation != 0 {
+		t.Errorf("after rollback: threads = %+v, reputation = %d, want neither", threads, profile.Reputation)
+	}
+
+	// Writes outside a failed transaction still work, and so do the IDs
+	thread := models.Thread{UserID: user.ID, CategoryID: 1, Title: "Hello", Content: "World"}
+	if _, err := stores.Threads.Create(ctx, &thread); err != nil {
+		t.Fatal(err)
+	}
+	if thread.ID != 1 {
+		t.Errorf("thread ID = %d, want 1 as the rolled back insert is undone", thread.ID)
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	ctx := context.Background()
+	stores := New().Stores()
+
+	err := stores.WithTx(ctx, func(tx *store.Stores) error {
+		return tx.Users.Create(ctx, &models.User{Username: "alice", Email: "alice@example.com"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.Users.GetByUsername(ctx, "alice"); err != nil {
+		t.Errorf("user created in a committed transaction: %v", err)
+	}
+}
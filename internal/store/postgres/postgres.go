@@ -0,0 +1,251 @@
+// Package postgres implements the store interfaces with the dataaccess packages
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/badges"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/categories"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/comments"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/identities"
+	reputationdata "github.com/blobfish465/common-circle-web-forum/internal/dataaccess/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/threads"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/users"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/verifications"
+	"github.com/blobfish465/common-circle-web-forum/internal/dataaccess/votes"
+	"github.com/blobfish465/common-circle-web-forum/internal/database"
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+	"github.com/blobfish465/common-circle-web-forum/internal/reputation"
+	"github.com/blobfish465/common-circle-web-forum/internal/store"
+)
+
+// New returns stores backed by db. When db is bound to a transaction, so are the stores.
+func New(db *database.Database) *store.Stores {
+	return &store.Stores{
+		Threads:       threadStore{db},
+		Comments:      commentStore{db},
+		Users:         userStore{db},
+		Categories:    categoryStore{db},
+		Votes:         voteStore{db},
+		Reputation:    reputationStore{db},
+		Badges:        badgeStore{db},
+		Verifications: verificationStore{db},
+		Identities:    identityStore{db},
+		Transactor:    transactor{db},
+	}
+}
+
+type transactor struct {
+	db *database.Database
+}
+
+// WithTx runs fn in a serializable transaction, retrying it on serialization failures
+func (t transactor) WithTx(ctx context.Context, fn func(tx *store.Stores) error) error {
+	return t.db.WithTx(ctx, func(tx *database.Database) error {
+		return fn(New(tx))
+	})
+}
+
+type threadStore struct {
+	db *database.Database
+}
+
+func (s threadStore) List(ctx context.Context) ([]models.Thread, error) {
+	return threads.List(ctx, s.db)
+}
+
+func (s threadStore) GetByID(ctx context.Context, id int) (*models.Thread, error) {
+	return threads.GetThreadByID(ctx, s.db, id)
+}
+
+func (s threadStore) ListByUserID(ctx context.Context, userID int) ([]models.Thread, error) {
+	return threads.ListByUserID(ctx, s.db, userID)
+}
+
+func (s threadStore) ListByCategoryID(ctx context.Context, categoryID int) ([]models.Thread, error) {
+	return threads.ListByCategoryID(ctx, s.db, categoryID)
+}
+
+func (s threadStore) Create(ctx context.Context, thread *models.Thread) (int, error) {
+	return threads.Create(ctx, s.db, thread)
+}
+
+func (s threadStore) Update(ctx context.Context, thread *models.Thread) error {
+	return threads.Update(ctx, s.db, thread)
+}
+
+func (s threadStore) Delete(ctx context.Context, id int) error {
+	return threads.Delete(ctx, s.db, id)
+}
+
+func (s threadStore) SetAcceptedComment(ctx context.Context, threadID int, commentID *int) error {
+	return threads.SetAcceptedComment(ctx, s.db, threadID, commentID)
+}
+
+type commentStore struct {
+	db *database.Database
+}
+
+func (s commentStore) List(ctx context.Context) ([]models.Comment, error) {
+	return comments.List(ctx, s.db)
+}
+
+func (s commentStore) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	return comments.GetCommentByID(ctx, s.db, id)
+}
+
+func (s commentStore) ListByThreadID(ctx context.Context, threadID int) ([]models.Comment, error) {
+	return comments.ListCommentsByThread(ctx, s.db, threadID)
+}
+
+func (s commentStore) ListByUserID(ctx context.Context, userID int) ([]models.Comment, error) {
+	return comments.ListCommentsByUserID(ctx, s.db, userID)
+}
+
+func (s commentStore) Create(ctx context.Context, comment *models.Comment) (int, error) {
+	return comments.Create(ctx, s.db, comment)
+}
+
+func (s commentStore) Update(ctx context.Context, comment *models.Comment) error {
+	return comments.Update(ctx, s.db, comment)
+}
+
+func (s commentStore) Delete(ctx context.Context, id int) error {
+	return comments.Delete(ctx, s.db, id)
+}
+
+type userStore struct {
+	db *database.Database
+}
+
+func (s userStore) List(ctx context.Context) ([]models.User, error) {
+	return users.List(ctx, s.db)
+}
+
+func (s userStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	return users.GetUserByID(ctx, s.db, id)
+}
+
+func (s userStore) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return users.GetUserByUsername(ctx, s.db, username)
+}
+
+func (s userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return users.GetUserByEmail(ctx, s.db, email)
+}
+
+func (s userStore) Create(ctx context.Context, user *models.User) error {
+	return users.Create(ctx, s.db, user)
+}
+
+// Delete removes a user along with the reputation they gave others. Both happen in one
+// transaction, so points are never taken back from an account that was not deleted.
+func (s userStore) Delete(ctx context.Context, id int) error {
+	return s.db.WithTx(ctx, func(tx *database.Database) error {
+		if err := reputation.RevokeAwardedBy(ctx, tx, id); err != nil {
+			return err
+		}
+		return users.Delete(ctx, tx, id)
+	})
+}
+
+func (s userStore) UpdateProfile(ctx context.Context, user *models.User) error {
+	return users.UpdateProfile(ctx, s.db, user)
+}
+
+func (s userStore) UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	return users.UpdatePasswordHash(ctx, s.db, userID, passwordHash)
+}
+
+func (s userStore) UpdateEmail(ctx context.Context, userID int, email string) error {
+	return users.UpdateEmail(ctx, s.db, userID, email)
+}
+
+func (s userStore) GetProfile(ctx context.Context, id int) (*models.UserProfile, error) {
+	return users.GetProfile(ctx, s.db, id)
+}
+
+func (s userStore) ListRecentActivity(ctx context.Context, userID int, limit int) ([]models.Activity, error) {
+	return users.ListRecentActivity(ctx, s.db, userID, limit)
+}
+
+func (s userStore) ListPostsSince(ctx context.Context, userID int, since time.Time, limit int) ([]models.Post, error) {
+	return users.ListPostsSince(ctx, s.db, userID, since, limit)
+}
+
+type categoryStore struct {
+	db *database.Database
+}
+
+func (s categoryStore) List(ctx context.Context) ([]models.Category, error) {
+	return categories.List(ctx, s.db)
+}
+
+func (s categoryStore) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	return categories.GetCategoryByID(ctx, s.db, id)
+}
+
+type voteStore struct {
+	db *database.Database
+}
+
+func (s voteStore) Add(ctx context.Context, userID int, target string, targetID int) (bool, error) {
+	return votes.Add(ctx, s.db, userID, target, targetID)
+}
+
+func (s voteStore) Remove(ctx context.Context, userID int, target string, targetID int) (bool, error) {
+	return votes.Remove(ctx, s.db, userID, target, targetID)
+}
+
+func (s voteStore) Count(ctx context.Context, target string, targetID int) (int, error) {
+	return votes.Count(ctx, s.db, target, targetID)
+}
+
+type reputationStore struct {
+	db *database.Database
+}
+
+func (s reputationStore) Adjust(ctx context.Context, userID int, points int) error {
+	return reputationdata.Adjust(ctx, s.db, userID, points)
+}
+
+type badgeStore struct {
+	db *database.Database
+}
+
+func (s badgeStore) Award(ctx context.Context, userID int, code string) (bool, error) {
+	return badges.Award(ctx, s.db, userID, code)
+}
+
+func (s badgeStore) ListAwarded(ctx context.Context, userID int) (map[string]time.Time, error) {
+	return badges.ListCodesByUserID(ctx, s.db, userID)
+}
+
+func (s badgeStore) GetActivityStats(ctx context.Context, userID int) (*models.ActivityStats, error) {
+	return badges.GetActivityStats(ctx, s.db, userID)
+}
+
+type verificationStore struct {
+	db *database.Database
+}
+
+func (s verificationStore) Create(ctx context.Context, userID int, email string, tokenHash string, expiresAt time.Time) error {
+	return verifications.Create(ctx, s.db, userID, email, tokenHash, expiresAt)
+}
+
+func (s verificationStore) Consume(ctx context.Context, tokenHash string) (*models.EmailVerification, error) {
+	return verifications.Consume(ctx, s.db, tokenHash)
+}
+
+type identityStore struct {
+	db *database.Database
+}
+
+func (s identityStore) GetByProviderSubject(ctx context.Context, provider string, subject string) (*models.LinkedIdentity, error) {
+	return identities.GetByProviderSubject(ctx, s.db, provider, subject)
+}
+
+func (s identityStore) Create(ctx context.Context, identity *models.LinkedIdentity) (int, error) {
+	return identities.Create(ctx, s.db, identity)
+}
@@ -0,0 +1,164 @@
+// Package store defines the storage interfaces the handlers use for threads, comments,
+// users, categories, votes, reputation, badges, email verifications and linked identities. The postgres
+// package implements them on top of dataaccess and the memory package implements them in
+// memory, so handlers can run without a database.
+//
+// Every implementation reports missing rows with apperrors.NotFound, duplicate usernames
+// and emails with apperrors.Conflict and references to missing rows with apperrors.Validation.
+package store
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/models"
+)
+
+// ThreadStore stores threads. Threads are returned with their author's username and reputation.
+type ThreadStore interface {
+	List(ctx context.Context) ([]models.Thread, error)
+	GetByID(ctx context.Context, id int) (*models.Thread, error)
+	ListByUserID(ctx context.Context, userID int) ([]models.Thread, error)
+	ListByCategoryID(ctx context.Context, categoryID int) ([]models.Thread, error)
+	// Create inserts a thread, setting its CreatedAt, and returns its ID
+	Create(ctx context.Context, thread *models.Thread) (int, error)
+	// Update saves the title, content and category of a thread
+	Update(ctx context.Context, thread *models.Thread) error
+	Delete(ctx context.Context, id int) error
+	// SetAcceptedComment marks a comment as the accepted answer, or clears it when commentID is nil
+	SetAcceptedComment(ctx context.Context, threadID int, commentID *int) error
+}
+
+// CommentStore stores comments
+type CommentStore interface {
+	List(ctx context.Context) ([]models.Comment, error)
+	GetByID(ctx context.Context, id int) (*models.Comment, error)
+	ListByThreadID(ctx context.Context, threadID int) ([]models.Comment, error)
+	// ListByUserID lists a user's comments, newest first
+	ListByUserID(ctx context.Context, userID int) ([]models.Comment, error)
+	// Create inserts a comment, setting its CreatedAt, and returns its ID
+	Create(ctx context.Context, comment *models.Comment) (int, error)
+	// Update saves the content of a comment
+	Update(ctx context.Context, comment *models.Comment) error
+	Delete(ctx context.Context, id int) error
+}
+
+// UserStore stores user accounts and builds their public profiles
+type UserStore interface {
+	List(ctx context.Context) ([]models.User, error)
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// GetByEmail looks a user up by email, ignoring case
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Create inserts a user, setting its ID and CreatedAt
+	Create(ctx context.Context, user *models.User) error
+	// Delete removes a user along with their threads and comments
+	Delete(ctx context.Context, id int) error
+	// UpdateProfile saves the username, display name, bio and avatar URL of a user
+	UpdateProfile(ctx context.Context, user *models.User) error
+	UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error
+	// UpdateEmail sets a user's email to an address they have verified
+	UpdateEmail(ctx context.Context, userID int, email string) error
+	GetProfile(ctx context.Context, id int) (*models.UserProfile, error)
+	// ListRecentActivity lists the latest threads and comments posted by a user, newest first
+	ListRecentActivity(ctx context.Context, userID int, limit int) ([]models.Activity, error)
+	// ListPostsSince lists up to limit threads and comments posted by a user after since, newest first
+	ListPostsSince(ctx context.Context, userID int, since time.Time, limit int) ([]models.Post, error)
+}
+
+// CategoryStore stores the forum's categories
+type CategoryStore interface {
+	List(ctx context.Context) ([]models.Category, error)
+	GetByID(ctx context.Context, id int) (*models.Category, error)
+}
+
+// VoteStore stores upvotes. The target is models.VoteTargetThread or models.VoteTargetComment.
+type VoteStore interface {
+	// Add records a user's upvote, returning false if they had already upvoted the target
+	Add(ctx context.Context, userID int, target string, targetID int) (bool, error)
+	// Remove deletes a user's upvote, returning false if there was none
+	Remove(ctx context.Context, userID int, target string, targetID int) (bool, error)
+	Count(ctx context.Context, target string, targetID int) (int, error)
+}
+
+// ReputationStore stores the points users have earned
+type ReputationStore interface {
+	// Adjust adds points, which may be negative, to a user's reputation
+	Adjust(ctx context.Context, userID int, points int) error
+}
+
+// BadgeStore stores the badges awarded to users
+type BadgeStore interface {
+	// Award gives a badge to a user, returning false if they already had it
+	Award(ctx context.Context, userID int, code string) (bool, error)
+	// ListAwarded returns when each of a user's badges was awarded, by badge code
+	ListAwarded(ctx context.Context, userID int) (map[string]time.Time, error)
+	// GetActivityStats counts a user's threads and comments and the days since they joined
+	GetActivityStats(ctx context.Context, userID int) (*models.ActivityStats, error)
+}
+
+// VerificationStore stores pending email changes by the hash of their token
+type VerificationStore interface {
+	// Create stores a pending change, replacing any earlier one of the same user
+	Create(ctx context.Context, userID int, email string, tokenHash string, expiresAt time.Time) error
+	// Consume removes the pending change with the token hash and returns it, so each token works once
+	Consume(ctx context.Context, tokenHash string) (*models.EmailVerification, error)
+}
+
+// IdentityStore stores the accounts at OpenID Connect providers that are linked to users
+type IdentityStore interface {
+	// GetByProviderSubject returns the identity linked for a provider's subject identifier
+	GetByProviderSubject(ctx context.Context, provider string, subject string) (*models.LinkedIdentity, error)
+	// Create links an identity to a user, setting its CreatedAt, and returns its ID
+	Create(ctx context.Context, identity *models.LinkedIdentity) (int, error)
+}
+
+// Transactor runs functions in a transaction
+type Transactor interface {
+	// WithTx calls fn with stores whose writes are kept if fn returns nil and undone if it
+	// returns an error. Calls made with the stores of a transaction join it. fn may be run
+	// again when the transaction conflicts with another, so it must not have side effects
+	// outside the stores, such as sending mail.
+	WithTx(ctx context.Context, fn func(tx *Stores) error) error
+}
+
+// Stores bundles the stores the handlers use
+type Stores struct {
+	Threads       ThreadStore
+	Comments      CommentStore
+	Users         UserStore
+	Categories    CategoryStore
+	Votes         VoteStore
+	Reputation    ReputationStore
+	Badges        BadgeStore
+	Verifications VerificationStore
+	Identities    IdentityStore
+	Transactor
+}
+
+type contextKey struct{}
+
+// Middleware makes stores available to the handlers through From
+func Middleware(stores *Stores) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithStores(r.Context(), stores)))
+		})
+	}
+}
+
+// WithStores returns a copy of ctx that carries stores
+func WithStores(ctx context.Context, stores *Stores) context.Context {
+	return context.WithValue(ctx, contextKey{}, stores)
+}
+
+// From returns the stores set up by Middleware. It panics if there are none, as that
+// means the router was set up without them.
+func From(ctx context.Context) *Stores {
+	stores, ok := ctx.Value(contextKey{}).(*Stores)
+	if !ok {
+		panic("store: no stores in context, is store.Middleware installed?")
+	}
+	return stores
+}
@@ -1,34 +1,22 @@
 package utils
 
 import (
-	"log"
-	"os"
+	"errors"
 	"time"
-	"github.com/dgrijalva/jwt-go"
-	"github.com/joho/godotenv"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-// jwtSecret holds the secret used to sign JWTs. It is initialized in the init function.
+// jwtSecret holds the secret used to sign JWTs. It is set by SetJWTSecret when the server starts.
 var jwtSecret []byte
 
 // Claims defines the structure of JWT claims.
 type Claims struct {
 	UserID string `json:"user_id"`
-	jwt.StandardClaims
+	jwt.RegisteredClaims
 }
 
-// init loads the .env file and initializes jwtSecret with the JWT_SECRET environment variable.
-func init() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(".env"); err != nil {
-		log.Println("Error loading .env file, falling back to system environment variables")
-	}
-
-	// Get JWT_SECRET from environment variables
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET is not set in the environment variables")
-	}
+// SetJWTSecret sets the secret used to sign and verify JWTs
+func SetJWTSecret(secret string) {
 	jwtSecret = []byte(secret)
 }
 
@@ -41,12 +29,16 @@ func GetJWTSecret() []byte {
 func GenerateJWT(userID string) (string, error) {
 	claims := &Claims{
 		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(), // Token expiration (e.g., 24 hours)
-			IssuedAt:  time.Now().Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expiration (e.g., 24 hours)
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	if len(jwtSecret) == 0 {
+		return "", errors.New("JWT secret is not set")
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
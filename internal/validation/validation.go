@@ -0,0 +1,189 @@
+// Package validation checks request payloads against rules declared in `validate` struct tags,
+// and collects field errors for checks that need more than the payload itself, such as
+// whether a referenced category exists.
+//
+// Supported rules, separated by commas:
+//
+//	required  strings must not be blank, numbers must not be zero, pointers must not be nil
+//	min=N     strings must have at least N characters, numbers must be at least N
+//	max=N     strings must have at most N characters, numbers must be at most N
+//	email     strings must be a single email address
+//	url       strings must be an absolute http or https URL
+//
+// Rules other than required are skipped for empty strings and nil pointers, so optional
+// fields are only checked when they are given. Fields are reported by their JSON name.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blobfish465/common-circle-web-forum/internal/apperrors"
+)
+
+// Errors collects the field errors found while validating a payload
+type Errors struct {
+	fields []apperrors.FieldError
+}
+
+// Add records that field is invalid
+func (e *Errors) Add(field string, format string, args ...interface{}) {
+	e.fields = append(e.fields, apperrors.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Has reports whether an error has already been recorded for field, which lets callers
+// skip checks such as database lookups for values that are already known to be bad
+func (e *Errors) Has(field string) bool {
+	for _, fieldErr := range e.fields {
+		if fieldErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an apperrors.Invalid error listing the recorded field errors, or nil if there are none
+func (e *Errors) Err() error {
+	if len(e.fields) == 0 {
+		return nil
+	}
+	return apperrors.Invalid(e.fields)
+}
+
+// Field returns an invalid error for a single field, for checks made after the payload has been decoded
+func Field(field string, format string, args ...interface{}) error {
+	errs := &Errors{}
+	errs.Add(field, format, args...)
+	return errs.Err()
+}
+
+// Struct validates the fields of the struct v points to against their `validate` tags.
+// Further checks can be added to the returned Errors before calling Err.
+func Struct(v interface{}) *Errors {
+	errs := &Errors{}
+
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return errs
+	}
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if message := check(value.Field(i), rule); message != "" {
+				errs.Add(jsonName(field), message)
+				// Report only the first failed rule of each field
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// check applies one rule to a field value and returns why it failed, or "" if it passed
+func check(field reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			if name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return checkString(field.String(), name, arg)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return checkInt(field.Int(), name, arg)
+	default:
+		panic(fmt.Sprintf("validation: unsupported field kind %s", field.Kind()))
+	}
+}
+
+func checkString(s string, name string, arg string) string {
+	if name == "required" {
+		if strings.TrimSpace(s) == "" {
+			return "is required"
+		}
+		return ""
+	}
+	if s == "" {
+		return ""
+	}
+
+	switch name {
+	case "min":
+		if n := mustAtoi(arg); utf8.RuneCountInString(s) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+	case "max":
+		if n := mustAtoi(arg); utf8.RuneCountInString(s) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+	case "email":
+		address, err := mail.ParseAddress(s)
+		if err != nil || address.Address != strings.TrimSpace(s) {
+			return "must be a valid email address"
+		}
+	case "url":
+		parsed, err := url.Parse(s)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "must be an absolute http or https URL"
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", name))
+	}
+	return ""
+}
+
+func checkInt(n int64, name string, arg string) string {
+	switch name {
+	case "required":
+		if n == 0 {
+			return "is required"
+		}
+	case "min":
+		if limit := mustAtoi(arg); n < int64(limit) {
+			return fmt.Sprintf("must be at least %d", limit)
+		}
+	case "max":
+		if limit := mustAtoi(arg); n > int64(limit) {
+			return fmt.Sprintf("must be at most %d", limit)
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q for a number", name))
+	}
+	return ""
+}
+
+// mustAtoi parses a rule argument. Tags are fixed at compile time, so a bad one is a programming error.
+func mustAtoi(arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid rule argument %q", arg))
+	}
+	return n
+}
+
+// jsonName returns the name a field has in JSON payloads
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}